@@ -59,6 +59,7 @@ type Arena struct {
 	Cells []Cell
 	Spawns [2][]*Cell
 	Goals [2]*Cell
+	GoalPaths [2][]int  // For each team's goal, the walking distance to it from every cell, or -1 if there's no path.
 }
 
 func LoadArena(filename string) (a *Arena) {
@@ -111,6 +112,7 @@ func NewArena(img image.Image) *Arena {
 
 	a.verifyValidArena()
 	a.calculateVisibility()
+	a.calculateGoalPaths()
 	return a
 }
 
@@ -147,6 +149,38 @@ func (a *Arena) calculateVisibility() {
 	logger.Printf("Created %d cell visibility links for %d cells.", visibleCells, len(a.Cells))
 }
 
+// Pre-calculate the shortest walking distance from every cell to each goal with a breadth-first search outward from the
+// goal. The arena never changes, so we only need to do this once on startup. Other bots are ignored, since they move.
+func (a *Arena) calculateGoalPaths() {
+	for team := TeamA; team <= TeamB; team++ {
+		distances := make([]int, len(a.Cells))
+		for i := range distances {
+			distances[i] = -1
+		}
+		goal := a.Goals[team]
+		distances[goal.X * a.Height + goal.Y] = 0
+
+		queue := []*Cell{goal}
+		for len(queue) > 0 {
+			cell := queue[0]
+			queue = queue[1:]
+			for dir := North; dir < NumberOfDirections; dir++ {
+				next := a.DestinationCellAfterMove(cell, dir)
+				if next != cell && distances[next.X * a.Height + next.Y] < 0 {
+					distances[next.X * a.Height + next.Y] = distances[cell.X * a.Height + cell.Y] + 1
+					queue = append(queue, next)
+				}
+			}
+		}
+		a.GoalPaths[team] = distances
+	}
+}
+
+// The number of steps it takes to walk from `c` to the given team's goal, or -1 if you can't get there from here.
+func (a *Arena) PathDistance(c *Cell, goalTeam Team) int {
+	return a.GoalPaths[goalTeam][c.X * a.Height + c.Y]
+}
+
 func (a *Arena) CanSee(src *Cell, dest *Cell) bool {
 	return src.VisibleFrom(dest)
 }
@@ -156,6 +190,22 @@ func (a *Arena) Distance(src *Cell, dest *Cell) int {
 	return intAbs(src.X - dest.X) + intAbs(src.Y - dest.Y)
 }
 
+// The absolute direction you'd have to go from `src` to get closest to `dest`. If it's diagonal, we go along whichever
+// axis has the longer distance.
+func (a *Arena) DirectionTo(src *Cell, dest *Cell) Direction {
+	dx, dy := dest.X - src.X, dest.Y - src.Y
+	if intAbs(dx) >= intAbs(dy) {
+		if dx > 0 {
+			return East
+		}
+		return West
+	}
+	if dy > 0 {
+		return South
+	}
+	return North
+}
+
 func (a *Arena) Reset() {
 	for i := 0; i < len(a.Cells); i++ {
 		a.Cells[i].Moves = 0
@@ -190,6 +240,18 @@ func (a *Arena) DestinationCellAfterMove(c *Cell, dir Direction) *Cell {
 	return c
 }
 
+// Returns the cell at the edge of the map in the given direction from `c`.
+func (a *Arena) EdgeCell(c *Cell, dir Direction) *Cell {
+	switch dir {
+	case North: return &a.Cells[c.X * a.Height]
+	case South: return &a.Cells[c.X * a.Height + a.Height - 1]
+	case East:  return &a.Cells[(a.Width - 1) * a.Height + c.Y]
+	case West:  return &a.Cells[c.Y]
+	}
+	logger.Fatalf("Weird direction %d!", dir)
+	return nil
+}
+
 // Verify that the map has five spawns and one goal for each team.
 func (a *Arena) verifyValidArena() {
 	var a_spawns, b_spawns, a_goals, b_goals int
@@ -15,10 +15,11 @@ type ArenaImage struct {
 	Image *image.RGBA
 }
 
-func NewArenaImage(name string, width, height, pixelsPerCell int) *ArenaImage {
+// The image is panelHeight pixels taller than the arena, to leave room for things that aren't part of the map.
+func NewArenaImage(name string, width, height, pixelsPerCell, panelHeight int) *ArenaImage {
 	return &ArenaImage{
 		name, width, height, pixelsPerCell,
-		image.NewRGBA(image.Rect(0, 0, width * pixelsPerCell, height * pixelsPerCell)),
+		image.NewRGBA(image.Rect(0, 0, width * pixelsPerCell, height * pixelsPerCell + panelHeight)),
 	}
 }
 
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Mutation and splicing often produce scripts that are identical to their parents, or that only differ in trivial
+// ways like `(+ 1 (tick))` versus `(+ (tick) 1)`. To spot those, we boil each script down to a canonical form: the
+// simplified tree, with the operands of commutative functions put in a fixed order. Two scripts with the same canonical
+// form always do the same thing.
+
+// Functions whose operands can be swapped without changing the result.
+var COMMUTATIVE_FUNCTIONS = map[string]bool{"+": true, "*": true, "min": true, "max": true, "=": true}
+
+// Returns a simplified copy of the tree in which equivalent expressions are written the same way.
+func CanonicalForm(tree *ScriptNode) *ScriptNode {
+	tree = copyTree(tree)
+	SimplifyTree(tree)
+	orderOperands(tree)
+	return tree
+}
+
+// The canonical form, squashed onto one line.
+func CanonicalString(tree *ScriptNode) string {
+	return oneLine(CanonicalForm(tree))
+}
+
+// A hash of the canonical form that stays the same across runs and builds, so that it can be saved to disk.
+func ScriptHash(tree *ScriptNode) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(CanonicalString(tree)))
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
+
+func copyTree(node *ScriptNode) *ScriptNode {
+	duplicate := *node
+	if node.Children != nil {
+		duplicate.Children = make([]*ScriptNode, len(node.Children))
+		for i, child := range node.Children {
+			duplicate.Children[i] = copyTree(child)
+		}
+	}
+	return &duplicate
+}
+
+// Works from the bottom up, so that the operands are already in order by the time we compare them.
+func orderOperands(node *ScriptNode) {
+	for _, child := range node.Children {
+		orderOperands(child)
+	}
+	if node.Type != Expr || len(node.Children) != 3 || hasEffects(node.Children[1]) || hasEffects(node.Children[2]) {
+		return
+	}
+
+	name := node.Children[0].Func.Name
+	if name == ">" {
+		// (> a b) is the same as (< b a).
+		node.Children[0] = &ScriptNode{Type: FuncName, Func: FunctionLookupTable["<"]}
+		node.Children[1], node.Children[2] = node.Children[2], node.Children[1]
+	} else if COMMUTATIVE_FUNCTIONS[name] && oneLine(node.Children[1]) > oneLine(node.Children[2]) {
+		node.Children[1], node.Children[2] = node.Children[2], node.Children[1]
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalForm(t *testing.T) {
+	same := [][2]string{
+		{"(move (+ 1 (tick)))", "(move (+ (tick) 1))"},
+		{"(move (* (tick) (+ 2 2)))", "(move (* 4 (tick)))"},
+		{"(if (> (tick) 3) (shoot-nearest) (wait))", "(if (< 3 (tick)) (shoot-nearest) (wait))"},
+		{"(if (= (my-x-pos) (min (tick) 3)) (wait) (move 1))", "(if (= (min 3 (tick)) (my-x-pos)) (wait) (move 1))"},
+		{"(if 1 (move 2) (wait))", "(move 2)"},
+		{"(defun 0 (move (max (arg-0) 1))) (call-0 (tick) 0)", "(defun 0 (move (max 1 (arg-0)))) (call-0 (tick) 0)"},
+	}
+	different := [][2]string{
+		{"(move (- 1 (tick)))", "(move (- (tick) 1))"},
+		{"(move (+ (rand 3) (rand 4)))", "(move (+ (rand 4) (rand 3)))"},
+		{"(move (+ (store 0 1) (load 0)))", "(move (+ (load 0) (store 0 1)))"},
+		{"(+ (move 1) (shoot 2))", "(+ (shoot 2) (move 1))"},
+		{"(defun 0 (move 1)) (call-0 1 2)", "(defun 0 (move 1)) (call-0 2 1)"},
+	}
+
+	for _, pair := range same {
+		a, b := MustParseScript(pair[0]), MustParseScript(pair[1])
+		assert.Equal(t, CanonicalString(a), CanonicalString(b), pair[0])
+		assert.Equal(t, ScriptHash(a), ScriptHash(b), pair[0])
+	}
+	for _, pair := range different {
+		assert.NotEqual(t, ScriptHash(MustParseScript(pair[0])), ScriptHash(MustParseScript(pair[1])), pair[0])
+	}
+}
+
+func TestCanonicalFormLeavesTreeAlone(t *testing.T) {
+	tree := MustParseScript("(move (+ (tick) (+ 1 1)))")
+	assert.Equal(t, "(move (+ (tick) 2))", CanonicalString(tree))
+	assert.Equal(t, "(move (+ (tick)\n         (+ 1 1)))\n", FormatScript(tree))
+}
+
+func TestScriptHashIsStable(t *testing.T) {
+	// The hashes get saved to disk, so they mustn't change between runs or builds.
+	assert.Equal(t, "db80a283abc05d58", ScriptHash(MustParseScript("(move (+ 1 (tick)))")))
+	assert.Regexp(t, "^[0-9a-f]{16}$", ScriptHash(MustParseScript("(shoot-nearest)")))
+}
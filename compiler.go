@@ -0,0 +1,200 @@
+package main
+
+// Walking the ScriptNode tree is slow: every expression has to look up its function, slice its children, and hand them
+// back to Eval one at a time. Compiling a script turns each node into a closure with its function and compiled
+// arguments already bound, so all that's left to do at runtime is call it.
+//
+// The compiled form has to behave exactly like Script.Eval, down to the number of steps it charges against the
+// evaluation budget, so that a match plays out the same way no matter which one we use. TestCompiledScriptsMatchEval
+// checks this.
+type CompiledNode func(s *Script) Result
+
+func CompileScript(node *ScriptNode) CompiledNode {
+	switch node.Type {
+	case Program:
+		main := CompileScript(node.Children[0])
+		subroutines := make([]CompiledNode, len(node.Children) - 1)
+		for i, child := range node.Children[1:] {
+			subroutines[i] = CompileScript(child)
+		}
+		return func(s *Script) Result {
+			s.subroutines, s.compiledSubroutines, s.level = nil, subroutines, NUM_SUBROUTINES
+			return main(s)
+		}
+	case Int:
+		result := Result{Type: ResultInt, Int: node.N}
+		return func(s *Script) Result {
+			if !s.step() {
+				return ResultOverBudget
+			}
+			return result
+		}
+	case Expr:
+		return compileExpr(node)
+	}
+	logger.Fatalf("Tried to compile a symbol! '%s'", node.Func.Name)
+	return nil
+}
+
+// Wraps the body of an expression with the same budget and depth checks that Eval does. Strict functions (the vast
+// majority) do their own checks so that we only need one function call per node.
+func compileExpr(node *ScriptNode) CompiledNode {
+	function := node.Children[0].Func
+	if function.Strict != nil {
+		return compileStrict(function.Strict, compileArgs(node))
+	}
+
+	body := compileSpecialForm(node)
+	return func(s *Script) Result {
+		if result, ok := s.enter(); !ok {
+			return result
+		}
+		result := body(s)
+		s.depth--
+		return result
+	}
+}
+
+// Does the same budget and depth checks as Eval. If it returns true, the caller must decrement s.depth when done.
+func (s *Script) enter() (Result, bool) {
+	if !s.step() {
+		return ResultOverBudget, false
+	}
+	s.depth++
+	if s.depth > MAX_EVAL_DEPTH {
+		s.depth--
+		return ResultTooDeep, false
+	}
+	return Result{}, true
+}
+
+func compileArgs(node *ScriptNode) []CompiledNode {
+	args := make([]CompiledNode, len(node.Children) - 1)
+	for i, child := range node.Children[1:] {
+		args[i] = CompileScript(child)
+	}
+	return args
+}
+
+func compileSpecialForm(node *ScriptNode) CompiledNode {
+	function := node.Children[0].Func
+	args := compileArgs(node)
+
+	switch function.Name {
+	case "if":
+		condition, ifTrue, ifFalse := args[0], args[1], args[2]
+		return func(s *Script) Result {
+			result := condition(s)
+			if result.Type != ResultInt {
+				return result
+			}
+			if result.Int > 0 {
+				return ifTrue(s)
+			}
+			return ifFalse(s)
+		}
+	case "and":
+		return func(s *Script) Result {
+			var condition Result = ResultFalse
+			for _, arg := range args {
+				condition = arg(s)
+				if condition.Type != ResultInt {
+					return condition
+				}
+				if condition.Int == 0 {
+					return ResultFalse
+				}
+			}
+			return condition
+		}
+	case "or":
+		return func(s *Script) Result {
+			for _, arg := range args {
+				condition := arg(s)
+				if condition.Type != ResultInt || condition.Int > 0 {
+					return condition
+				}
+			}
+			return ResultFalse
+		}
+	case "not":
+		arg := args[0]
+		return func(s *Script) Result {
+			condition := arg(s)
+			if condition.Type == ResultError {
+				return condition
+			}
+			return boolResult(condition.Int <= 0)
+		}
+	}
+
+	// We don't know how to compile this special form, so fall back to walking the tree for it.
+	code, children := function.Code, node.Children[1:]
+	return func(s *Script) Result {
+		return code(s, children)
+	}
+}
+
+// We unroll the common arities so that we don't have to loop over the arguments.
+func compileStrict(impl StrictCode, args []CompiledNode) CompiledNode {
+	switch len(args) {
+	case 0:
+		return func(s *Script) Result {
+			if result, ok := s.enter(); !ok {
+				return result
+			}
+			result := impl(s, StrictArgs{})
+			s.depth--
+			return result
+		}
+	case 1:
+		a := args[0]
+		return func(s *Script) Result {
+			if result, ok := s.enter(); !ok {
+				return result
+			}
+			result := a(s)
+			if result.Type == ResultInt {
+				result = impl(s, StrictArgs{result.Int})
+			}
+			s.depth--
+			return result
+		}
+	case 2:
+		a, b := args[0], args[1]
+		return func(s *Script) Result {
+			if result, ok := s.enter(); !ok {
+				return result
+			}
+			result := a(s)
+			if result.Type == ResultInt {
+				resultB := b(s)
+				if resultB.Type == ResultInt {
+					result = impl(s, StrictArgs{result.Int, resultB.Int})
+				} else {
+					result = resultB
+				}
+			}
+			s.depth--
+			return result
+		}
+	}
+
+	return func(s *Script) Result {
+		if result, ok := s.enter(); !ok {
+			return result
+		}
+		var values StrictArgs
+		for i, arg := range args {
+			result := arg(s)
+			if result.Type != ResultInt {
+				s.depth--
+				return result
+			}
+			values[i] = result.Int
+		}
+		result := impl(s, values)
+		s.depth--
+		return result
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sharedArena *Arena
+var loadArenaOnce sync.Once
+
+// Calculating visibility for the real arena takes a while, so we only want to do it once per test run.
+func testArena() *Arena {
+	loadArenaOnce.Do(func() {
+		sharedArena = LoadArena("arena.png")
+	})
+	return sharedArena
+}
+
+// Scatters the bots randomly around the arena and fills in their memories and blackboards with junk.
+func randomGameState(arena *Arena, rng *rand.Rand) *GameState {
+	state := NewGameState(arena)
+	state.Tick = rng.Intn(MAX_TICKS_PER_GAME)
+
+	for i := range state.Bots {
+		bot := &state.Bots[i]
+		bot.Alive = false
+		for {
+			cell := &arena.Cells[rng.Intn(len(arena.Cells))]
+			if state.CellIsEmpty(cell) {
+				bot.Position = cell
+				break
+			}
+		}
+		bot.Alive = rng.Intn(4) > 0
+		for j := range bot.Memory {
+			bot.Memory[j] = rng.Intn(10)
+		}
+	}
+	for team := range state.Blackboards {
+		for j := range state.Blackboards[team] {
+			state.Blackboards[team][j] = rng.Intn(10)
+		}
+	}
+	for i := range state.Goals {
+		state.Goals[i].Alive = rng.Intn(10) > 0
+	}
+
+	state.CurrentBot = &state.Bots[rng.Intn(len(state.Bots))]
+	state.CurrentBot.Alive = true
+	return state
+}
+
+func TestCompiledScriptsMatchEval(t *testing.T) {
+	arena := testArena()
+
+	for i := 0; i < 500; i++ {
+		tree := RandomTree(1 + rand.Intn(MAX_EXPRS_PER_SCRIPT))
+		compiled := CompileScript(tree)
+
+		for j := 0; j < 5; j++ {
+			seed := int64(i * 5 + j)
+			walkedState := randomGameState(arena, rand.New(rand.NewSource(seed)))
+			compiledState := randomGameState(arena, rand.New(rand.NewSource(seed)))
+
+			walked := Script{Code: tree, State: walkedState, Budget: DEFAULT_EVAL_BUDGET}
+			fast := Script{Code: tree, Compiled: compiled, State: compiledState, Budget: DEFAULT_EVAL_BUDGET}
+			walkedResult, fastResult := walked.Run(), fast.Run()
+
+			same := walkedResult == fastResult &&
+			        walked.steps == fast.steps &&
+			        walked.OverBudget == fast.OverBudget &&
+			        walkedState.Blackboards == compiledState.Blackboards &&
+			        walkedState.CurrentBot.Memory == compiledState.CurrentBot.Memory &&
+			        assert.ObjectsAreEqual(walkedState.Broadcasts, compiledState.Broadcasts)
+			if !same {
+				t.Fatalf("Compiled script diverged on state %d: got %+v after %d steps, expected %+v after %d steps. Script:\n%s",
+								 seed, fastResult, fast.steps, walkedResult, walked.steps, FormatScript(tree))
+			}
+		}
+	}
+}
+
+func benchmarkScripts(b *testing.B) ([]*ScriptNode, []*GameState) {
+	arena := testArena()
+	trees := make([]*ScriptNode, 100)
+	states := make([]*GameState, 100)
+	for i := range trees {
+		trees[i] = RandomTree(200)
+		states[i] = randomGameState(arena, rand.New(rand.NewSource(int64(i))))
+	}
+	b.ResetTimer()
+	return trees, states
+}
+
+func BenchmarkTreeWalker(b *testing.B) {
+	trees, states := benchmarkScripts(b)
+	for n := 0; n < b.N; n++ {
+		state := states[n % len(states)]
+		state.Broadcasts = state.Broadcasts[:0]
+		script := Script{Code: trees[n % len(trees)], State: state, Budget: DEFAULT_EVAL_BUDGET}
+		script.Run()
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	trees, states := benchmarkScripts(b)
+	compiled := make([]CompiledNode, len(trees))
+	for i, tree := range trees {
+		compiled[i] = CompileScript(tree)
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		state := states[n % len(states)]
+		state.Broadcasts = state.Broadcasts[:0]
+		script := Script{Compiled: compiled[n % len(trees)], State: state, Budget: DEFAULT_EVAL_BUDGET}
+		script.Run()
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import "math/rand"
+
+// Different ways of combining two scripts. The scenario decides which one gets used.
+type CrossoverStrategy int
+const (
+	SubtreeCrossover CrossoverStrategy = iota   // Puts any branch of B anywhere in A that it fits.
+	SizeFairCrossover                           // Like subtree, but the new branch can't be much bigger than the old one.
+	OnePointCrossover                           // Only swaps branches at the same place in A and B, where they line up.
+	NumberOfCrossoverStrategies
+)
+
+var CROSSOVER_STRATEGY_NAMES = [NumberOfCrossoverStrategies]string{"subtree", "size-fair", "one-point"}
+
+func (strategy CrossoverStrategy) String() string {
+	return CROSSOVER_STRATEGY_NAMES[strategy]
+}
+
+func ParseCrossoverStrategy(name string) (CrossoverStrategy, error) {
+	strategy, err := lookUpName(CROSSOVER_STRATEGY_NAMES[:], name, "crossover strategy")
+	return CrossoverStrategy(strategy), err
+}
+
+// Puts a branch of script B somewhere in script A, using the scenario's crossover strategy.
+func SpliceScripts(scriptA, scriptB string) (string, error) {
+	treeA, err := ParseScript(scriptA)
+	if err != nil {
+		return "", err
+	}
+	treeB, err := ParseScript(scriptB)
+	if err != nil {
+		return "", err
+	}
+	treeA = withSubroutines(treeA)
+	if treeB.Type != Program {
+		// Make sure that B's main body can be picked too. We don't need to give it any subroutines.
+		treeB = &ScriptNode{Type: Program, Children: []*ScriptNode{treeB}}
+	}
+
+	if !crossTrees(treeA, treeB, CurrentConfig.crossover) {
+		// The parts of A and B that have the same shape might already be identical, but subtree crossover always works.
+		crossTrees(treeA, treeB, SubtreeCrossover)
+	}
+	randomlyPruneTree(treeA)
+	return FormatScript(treeA), nil
+}
+
+// Changes A in place. Returns false if the strategy can't find anything in B to put in A.
+func crossTrees(treeA, treeB *ScriptNode, strategy CrossoverStrategy) bool {
+	switch strategy {
+	case SizeFairCrossover:
+		return sizeFairCrossover(treeA, treeB)
+	case OnePointCrossover:
+		return onePointCrossover(treeA, treeB)
+	}
+
+	// Both scripts have at least one place that takes an action, so we'll always find something that fits eventually.
+	for {
+		replacement := chooseRandomLocation(treeB)
+		if replaceRandomNode(treeA, copyTree(replacement.Node), replacement.Type, 0) {
+			return true
+		}
+	}
+}
+
+// Picks the branch of A to replace first, then picks a branch of B that's at most twice its size (plus one, so that
+// single numbers can grow). Crossover can't make a script much bigger than it was, which keeps bloat in check.
+func sizeFairCrossover(treeA, treeB *ScriptNode) bool {
+	targets := linearizeChildren(treeA)
+	rand.Shuffle(len(targets), func(i, j int) {
+		targets[i], targets[j] = targets[j], targets[i]
+	})
+	sources := copyableBranches(treeB)
+
+	for _, target := range targets {
+		if target.Node.Type == FuncName {
+			continue
+		}
+		maxSize := 2 * target.Node.Size() + 1
+		candidates := []*ScriptNode{}
+		for _, source := range sources {
+			if typeFits(target.Type, source.Type) && source.Node.Size() <= maxSize {
+				candidates = append(candidates, source.Node)
+			}
+		}
+		if len(candidates) > 0 {
+			target.Parent.Children[target.Index] = copyTree(candidates[rand.Intn(len(candidates))])
+			return true
+		}
+	}
+	return false
+}
+
+// Lines the two trees up from the top, and swaps a branch that's in the same place in both of them. The branches
+// keep their context, so the child tends to do the same sort of thing as its parents.
+func onePointCrossover(treeA, treeB *ScriptNode) bool {
+	type crossoverPoint struct {
+		target TreeLocation
+		source *ScriptNode
+	}
+	points := []crossoverPoint{}
+
+	var align func(a, b TreeLocation)
+	align = func(a, b TreeLocation) {
+		if !typeFits(a.Type, b.Type) {
+			return
+		}
+		if !sameCode(a.Node, b.Node) && typeCheckNode(b.Node, b.Type) == nil {
+			points = append(points, crossoverPoint{a, b.Node})
+		}
+		if !sameShape(a.Node, b.Node, a.Type, b.Type) {
+			return
+		}
+		for i := 1; i < len(a.Node.Children); i++ {
+			align(childLocation(a, i), childLocation(b, i))
+		}
+	}
+	// The main bodies line up with each other, and so do the subroutines with the same numbers.
+	for i := 0; i < intMin(len(treeA.Children), len(treeB.Children)); i++ {
+		align(TreeLocation{treeA.Children[i], treeA, i, SCRIPT_TYPE}, TreeLocation{treeB.Children[i], treeB, i, SCRIPT_TYPE})
+	}
+	if len(points) == 0 {
+		return false
+	}
+
+	point := points[rand.Intn(len(points))]
+	point.target.Parent.Children[point.target.Index] = copyTree(point.source)
+	return true
+}
+
+// Are these both calls to functions that take the same number and types of arguments?
+func sameShape(a, b *ScriptNode, aType, bType ValueType) bool {
+	if a.Type != Expr || b.Type != Expr {
+		return false
+	}
+	fnA, fnB := a.Children[0].Func, b.Children[0].Func
+	if fnA.Arity != fnB.Arity {
+		return false
+	}
+	for i := range fnA.ArgTypes {
+		if resolveType(fnA.ArgTypes[i], aType) != resolveType(fnB.ArgTypes[i], bType) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useCrossover(t *testing.T, strategy CrossoverStrategy) {
+	assert.NoError(t, withScenarioConfig(t, func(config *ScenarioConfig) { config.Crossover = strategy.String() }))
+}
+
+func TestSizeFairCrossover(t *testing.T) {
+	useCrossover(t, SizeFairCrossover)
+
+	// The big branch of B is too big to replace anything in A except its main body.
+	scriptA := BORING_SUBROUTINES + "(if (enemy-visible?) (shoot-nearest) (move 1))"
+	scriptB := "(if (< (+ (tick) (tick)) (* (tick) (tick))) (shoot (+ (tick) (tick))) (move (* (tick) 3)))"
+	for i := 0; i < 100; i++ {
+		spliced, err := SpliceScripts(scriptA, scriptB)
+		assert.NoError(t, err)
+		tree := MustParseScript(spliced)
+		assert.NoError(t, TypeCheck(tree), spliced)
+		assert.LessOrEqual(t, tree.Size(), 2 * MustParseScript(scriptA).Size() + 1, spliced)
+	}
+}
+
+func TestOnePointCrossover(t *testing.T) {
+	useCrossover(t, OnePointCrossover)
+
+	// Only the `if`s line up, so the only things that can move are their arguments and the whole main body.
+	scriptA := BORING_SUBROUTINES + "(if (enemy-visible?) (shoot-nearest) (move 1))"
+	scriptB := BORING_SUBROUTINES + "(if (ally-visible?) (move (+ 2 (tick))) (move 1))"
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		spliced, err := SpliceScripts(scriptA, scriptB)
+		assert.NoError(t, err)
+		seen[oneLine(MustParseScript(spliced))] = true
+	}
+	assert.Equal(t, map[string]bool{
+		BORING_SUBROUTINES + "(if (ally-visible?) (shoot-nearest) (move 1))": true,
+		BORING_SUBROUTINES + "(if (enemy-visible?) (move (+ 2 (tick))) (move 1))": true,
+		BORING_SUBROUTINES + "(if (ally-visible?) (move (+ 2 (tick))) (move 1))": true,
+	}, seen)
+
+	// When the parts that line up are all the same, it falls back to subtree crossover.
+	spliced, err := SpliceScripts(scriptA, scriptA)
+	assert.NoError(t, err)
+	assert.NoError(t, TypeCheck(MustParseScript(spliced)), spliced)
+}
+
+func TestCrossoverStrategyConfig(t *testing.T) {
+	crossover := func(name string) func(*ScenarioConfig) {
+		return func(config *ScenarioConfig) { config.Crossover = name }
+	}
+
+	assert.Error(t, withScenarioConfig(t, crossover("fnord")))
+	assert.NoError(t, withScenarioConfig(t, crossover("one-point")))
+	assert.Equal(t, OnePointCrossover, CurrentConfig.crossover)
+}
+
+func TestOperatorsRespectMaxDepth(t *testing.T) {
+	for strategy := SubtreeCrossover; strategy < NumberOfCrossoverStrategies; strategy++ {
+		useCrossover(t, strategy)
+		for i := 0; i < 20; i++ {
+			tree := RandomTree(MAX_EXPRS_PER_SCRIPT)
+			assert.LessOrEqual(t, tree.Depth(), MAX_DEPTH_PER_SCRIPT)
+
+			mutated, _, err := MutateScript(FormatScript(tree))
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, MustParseScript(mutated).Depth(), MAX_DEPTH_PER_SCRIPT)
+
+			spliced, err := SpliceScripts(mutated, RandomScript(MAX_EXPRS_PER_SCRIPT))
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, MustParseScript(spliced).Depth(), MAX_DEPTH_PER_SCRIPT)
+		}
+	}
+
+	// Hand-written scripts can be as deep as they like, but anything we make from them gets pruned.
+	deep := "(shoot-nearest)"
+	for i := 0; i < MAX_DEPTH_PER_SCRIPT; i++ {
+		deep = "(if (enemy-visible?) " + deep + " (wait))"
+	}
+	mutated, _, err := MutateScript(deep)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, MustParseScript(mutated).Depth(), MAX_DEPTH_PER_SCRIPT)
+}
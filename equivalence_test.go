@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Anything that rewrites a script has to leave it doing exactly what it did before. This harness runs random scripts
+// and their rewritten versions side by side on random game states from the real arena, and if they ever disagree, it
+// shrinks the script down to the smallest one that still shows the problem.
+
+// A rewrite that's supposed to preserve a script's behaviour.
+type scriptTransform struct {
+	name string
+	apply func(tree *ScriptNode) (*ScriptNode, CompiledNode)   // The compiled code is nil if we should walk the tree.
+	sameCost bool   // True if the transformed script should take exactly the same number of steps.
+}
+
+var scriptTransforms = []scriptTransform{
+	{"format and parse", func(tree *ScriptNode) (*ScriptNode, CompiledNode) {
+		return MustParseScript(FormatScript(tree)), nil
+	}, true},
+	{"compile", func(tree *ScriptNode) (*ScriptNode, CompiledNode) {
+		return tree, CompileScript(tree)
+	}, true},
+	{"simplify", func(tree *ScriptNode) (*ScriptNode, CompiledNode) {
+		tree = copyTree(tree)
+		SimplifyTree(tree)
+		return tree, nil
+	}, false},
+	{"canonical form", func(tree *ScriptNode) (*ScriptNode, CompiledNode) {
+		return CanonicalForm(tree), nil
+	}, false},
+}
+
+// Everything a script can do to the outside world when it runs.
+type scriptOutcome struct {
+	Result Result
+	Steps int
+	Memory [MEMORY_REGISTERS]int
+	Blackboards [2][BLACKBOARD_CHANNELS]int
+	Broadcasts []Broadcast
+	RandomNumbers int   // The next number from the game's random number generator, to check that the script used the same amount
+}
+
+func runForOutcome(tree *ScriptNode, compiled CompiledNode, stateSeed int64) scriptOutcome {
+	state := randomGameState(testArena(), rand.New(rand.NewSource(stateSeed)))
+	state.Rand = rand.New(rand.NewSource(stateSeed))
+
+	// We look at the raw result instead of using Run, which turns every number into a wait.
+	script := Script{Code: tree, Compiled: compiled, State: state}
+	var result Result
+	if compiled != nil {
+		result = compiled(&script)
+	} else {
+		result = script.Eval(tree)
+	}
+	return scriptOutcome{result, script.steps, state.CurrentBot.Memory, state.Blackboards, state.Broadcasts, state.Rand.Int()}
+}
+
+// Returns a description of how the transformed script behaves differently from the original on the given state, or
+// "" if they behave the same.
+func divergence(transform scriptTransform, tree *ScriptNode, stateSeed int64) string {
+	transformed, compiled := transform.apply(tree)
+	expected := runForOutcome(tree, nil, stateSeed)
+	actual := runForOutcome(transformed, compiled, stateSeed)
+
+	if !transform.sameCost {
+		if expected.Result.Type == ResultError {
+			return ""   // The transformed script might not run out of budget where the original did.
+		}
+		actual.Steps = expected.Steps
+	}
+	if reflect.DeepEqual(expected, actual) {
+		return ""
+	}
+	return fmt.Sprintf("expected %s, got %s", describeOutcome(expected), describeOutcome(actual))
+}
+
+func describeOutcome(o scriptOutcome) string {
+	var result string
+	switch o.Result.Type {
+	case ResultInt:
+		result = fmt.Sprintf("%d", o.Result.Int)
+	case ResultError:
+		result = o.Result.Err.Error()
+	case ResultAction:
+		result = fmt.Sprintf("action %d", o.Result.Action.Type)
+		if o.Result.Action.Target != nil {
+			result += fmt.Sprintf(" at (%d, %d)", o.Result.Action.Target.X, o.Result.Action.Target.Y)
+		}
+	}
+	return fmt.Sprintf("%s after %d steps (memory %v, blackboards %v, broadcasts %+v, next random number %d)",
+	                   result, o.Steps, o.Memory, o.Blackboards, o.Broadcasts, o.RandomNumbers)
+}
+
+func describeState(stateSeed int64) string {
+	state := randomGameState(testArena(), rand.New(rand.NewSource(stateSeed)))
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("randomGameState(testArena(), rand.New(rand.NewSource(%d))): tick %d, current bot %d\n",
+	                           stateSeed, state.Tick, state.CurrentBot.Id))
+	for _, bot := range state.Bots {
+		if bot.Alive {
+			sb.WriteString(fmt.Sprintf("  bot %d at (%d, %d), memory %v\n", bot.Id, bot.Position.X, bot.Position.Y, bot.Memory))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("  goals alive: %v, %v; blackboards %v\n", state.Goals[TeamA].Alive, state.Goals[TeamB].Alive,
+	                           state.Blackboards))
+	return sb.String()
+}
+
+// Makes the script as small as we can while keeping the divergence, by repeatedly replacing expressions with one of
+// their arguments or with a constant.
+func shrinkDivergentScript(transform scriptTransform, tree *ScriptNode, stateSeed int64) *ScriptNode {
+	for shrunk := true; shrunk; {
+		shrunk = false
+		for i, location := range linearizeChildren(tree) {
+			if location.Node.Type == FuncName {
+				continue
+			}
+			candidates := []*ScriptNode{{Type: Int, N: 0}, {Type: Int, N: 1}}
+			if location.Node.Type == Expr {
+				candidates = append(candidates, location.Node.Children[1:]...)
+			}
+			for _, candidate := range candidates {
+				if candidate.Size() >= location.Node.Size() {
+					continue
+				}
+				smaller := copyTree(tree)
+				spot := linearizeChildren(smaller)[i]
+				spot.Parent.Children[spot.Index] = copyTree(candidate)
+				if divergence(transform, smaller, stateSeed) != "" {
+					tree, shrunk = smaller, true
+					break
+				}
+			}
+			if shrunk {
+				break
+			}
+		}
+	}
+	return tree
+}
+
+// Checks every transform against the script on each of the states, and fails the test with a minimal reproduction
+// at the first divergence.
+func checkTransforms(t *testing.T, tree *ScriptNode, stateSeeds ...int64) {
+	for _, transform := range scriptTransforms {
+		for _, seed := range stateSeeds {
+			if divergence(transform, tree, seed) == "" {
+				continue
+			}
+			small := shrinkDivergentScript(transform, tree, seed)
+			transformed, _ := transform.apply(small)
+			t.Fatalf("'%s' changed what a script does: %s\nState: %s\nScript:\n%s\nAfter '%s':\n%s",
+			         transform.name, divergence(transform, small, seed), describeState(seed), FormatScript(small),
+			         transform.name, FormatScript(transformed))
+		}
+	}
+}
+
+func TestTransformsPreserveBehaviour(t *testing.T) {
+	for i := 0; i < 300; i++ {
+		checkTransforms(t, RandomTree(1 + rand.Intn(MAX_EXPRS_PER_SCRIPT / 2)), int64(i * 3), int64(i * 3 + 1), int64(i * 3 + 2))
+	}
+}
+
+func TestShrinkDivergentScript(t *testing.T) {
+	// A deliberately broken transform that turns every 'min' into 'max'.
+	broken := scriptTransform{"break min", func(tree *ScriptNode) (*ScriptNode, CompiledNode) {
+		tree = copyTree(tree)
+		for _, location := range linearizeChildren(tree) {
+			if location.Node.Type == FuncName && location.Node.Func.Name == "min" {
+				location.Node.Func = FunctionLookupTable["max"]
+			}
+		}
+		return tree, nil
+	}, true}
+
+	tree := MustParseScript("(if (enemy-visible?) (move (+ (tick) (min 2 (my-id)))) (shoot (+ 1 (min 3 1))))")
+	var seed int64
+	for seed = 0; divergence(broken, tree, seed) == ""; seed++ {}
+	small := shrinkDivergentScript(broken, tree, seed)
+	if small.Size() >= tree.Size() || !strings.Contains(FormatScript(small), "min") {
+		t.Errorf("Didn't shrink the script properly:\n%s", FormatScript(small))
+	}
+}
+
+// Run with `go test -fuzz FuzzTransforms` to search for divergences for as long as you like.
+func FuzzTransforms(f *testing.F) {
+	for i := int64(0); i < 10; i++ {
+		f.Add(i, i, uint16(20 * i))
+	}
+	f.Fuzz(func(t *testing.T, scriptSeed int64, stateSeed int64, size uint16) {
+		rand.Seed(scriptSeed)
+		checkTransforms(t, RandomTree(1 + int(size) % MAX_EXPRS_PER_SCRIPT), stateSeed)
+	})
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Evolved scripts are mostly deeply nested `if`s, which are hard to follow even after they've been simplified. The
+// explainer flattens a script into a list of rules in priority order: the bot takes the action of the first rule whose
+// conditions all hold. Directions are named from the team's point of view, so "north" is always toward the enemy goal.
+
+type Rule struct {
+	Conditions []Condition
+	Action string
+}
+
+// Two conditions are the same test if they have the same key. Most conditions give the same answer every time they're
+// checked, so the text is enough. Ones that use up a random number or change something can give a different answer
+// each time, so they only match themselves. Each call works out its arguments once, so conditions that depend on an
+// argument like that only match the same text within the same call.
+type Condition struct {
+	Text string
+	key conditionKey
+}
+
+type conditionKey struct {
+	text string
+	call *explainer   // Set if the condition depends on one of this call's arguments with side effects,
+	node *ScriptNode  // and this too if the condition has side effects of its own.
+}
+
+type explainer struct {
+	program *ScriptNode
+	level int          // The subroutine we're in, or NUM_SUBROUTINES for the main body. See Script.level.
+	args []*ScriptNode // The arguments that the current subroutine was called with,
+	caller *explainer  // and the code that they came from.
+}
+
+var DIRECTION_NAMES = []string{"north", "south", "east", "west"}
+
+// The direction sensors, described as places you might go.
+var DIRECTION_SENSORS = map[string]string{
+	"enemy-direction": "toward the nearest enemy",
+	"ally-direction": "toward the nearest ally",
+	"enemy-goal-direction": "toward the enemy goal",
+	"own-goal-direction": "toward our goal",
+	"step-toward-enemy-goal": "along the path to the enemy goal",
+	"step-toward-own-goal": "along the path to our goal",
+}
+
+// Functions that are written between their operands, like `tick + 1`.
+var INFIX_FUNCTIONS = map[string]bool{"+": true, "-": true, "*": true, "/": true, "mod": true}
+
+// Returns the rules that the script follows, in the order that it checks them.
+func ExplainScript(tree *ScriptNode) []Rule {
+	tree = copyTree(tree)
+	SimplifyTree(tree)
+
+	var rules []Rule
+	if tree.Type == Program {
+		rules = (&explainer{tree, NUM_SUBROUTINES, nil, nil}).flatten(tree.Children[0], nil)
+	} else {
+		rules = (&explainer{nil, 0, nil, nil}).flatten(tree, nil)
+	}
+	return tidyRules(rules)
+}
+
+// Turns the rules into an if/else-if list, one rule per line.
+func FormatRules(rules []Rule) string {
+	var sb strings.Builder
+	for i, rule := range rules {
+		switch {
+		case len(rule.Conditions) == 0 && i == 0:
+			sb.WriteString("always")
+		case len(rule.Conditions) == 0:
+			sb.WriteString("otherwise")
+		case i == 0:
+			sb.WriteString("if " + joinConditions(rule.Conditions))
+		default:
+			sb.WriteString("else if " + joinConditions(rule.Conditions))
+		}
+		sb.WriteString(" → " + rule.Action + "\n")
+	}
+	return sb.String()
+}
+
+// Prints the rules for one of the scripts in a generation.
+func ExplainFile(scenario string, genId int, scriptId int) {
+	code := NewFileManager(scenario, genId).ScriptCode(scriptId)
+	tree, err := ParseScript(code)
+	if err != nil {
+		logger.Fatalf("Can't parse script %d: %v", scriptId, err)
+	}
+	fmt.Print(FormatRules(ExplainScript(tree)))
+}
+
+// Returns the rules for the node, each of which also requires the given conditions. The last rule only has the given
+// conditions, so the rules always cover every possibility between them.
+func (e *explainer) flatten(node *ScriptNode, conditions []Condition) []Rule {
+	rule := func(action string) []Rule {
+		return []Rule{{conditions, action}}
+	}
+	if !canAct(node) {
+		return rule("wait")   // Run turns numbers into waits.
+	}
+
+	name := node.Children[0].Func.Name
+	args := node.Children[1:]
+	switch name {
+	case "if":
+		if canAct(args[0]) {
+			break
+		}
+		withCondition := append(append([]Condition{}, conditions...), e.condition(args[0]))
+		return append(e.flatten(args[1], withCondition), e.flatten(args[2], conditions)...)
+	case "move", "shoot":
+		if canAct(args[0]) {
+			break
+		}
+		return rule(name + " " + e.direction(args[0]))
+	case "shoot-nearest":
+		return rule("shoot the nearest enemy")
+	case "wait":
+		return rule("wait")
+	}
+
+	var n int
+	if _, err := fmt.Sscanf(name, "call-%d", &n); err == nil && !anyCanAct(args) {
+		if n >= e.level || e.program == nil {
+			return rule("wait")
+		}
+		return (&explainer{e.program, n, args, e}).flatten(e.program.Children[n + 1], conditions)
+	}
+
+	// Code that mixes actions into its arithmetic or logic doesn't fit into a simple list of rules.
+	return rule(fmt.Sprintf("whatever %s does", oneLine(node)))
+}
+
+// The condition that the node is greater than zero, as a clause of a rule.
+func (e *explainer) condition(node *ScriptNode) Condition {
+	text := e.clause(node, false, "or")
+	switch {
+	case hasSideEffects(node):
+		return Condition{text, conditionKey{text, e, node}}
+	case e.usesEffectfulArgs(node):
+		return Condition{text, conditionKey{text, e, nil}}
+	}
+	return Condition{text, conditionKey{text, nil, nil}}
+}
+
+// Returns true if the node uses an argument of the current call that has side effects, or that uses one of the
+// caller's arguments that does.
+func (e *explainer) usesEffectfulArgs(node *ScriptNode) bool {
+	if node.Type != Expr {
+		return false
+	}
+	if arg, _ := e.arg(node); arg != nil {
+		return hasSideEffects(arg) || e.caller.usesEffectfulArgs(arg)
+	}
+	for _, child := range node.Children[1:] {
+		if e.usesEffectfulArgs(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// Describes the condition that the node is greater than zero, or not equal to zero if `nonZero` is set.
+func (e *explainer) truth(node *ScriptNode, nonZero bool) string {
+	if node.Type == Int {
+		if (nonZero && node.N != 0) || node.N > 0 {
+			return "true"
+		}
+		return "false"
+	}
+
+	args := node.Children[1:]
+	switch node.Children[0].Func.Name {
+	case "and":
+		// 'and' returns its last argument if the first one isn't zero.
+		return e.clause(args[0], true, "or") + " and " + e.clause(args[1], nonZero, "or")
+	case "or":
+		return e.clause(args[0], false, "and") + " or " + e.clause(args[1], false, "and")
+	case "not":
+		return e.falsity(args[0])
+	case "if":
+		return fmt.Sprintf("(%s if %s, else %s)", e.truth(args[1], nonZero), e.truth(args[0], false),
+		                   e.truth(args[2], nonZero))
+	}
+
+	if isZeroOrOne(node) {
+		return e.predicate(node)
+	}
+	if nonZero {
+		return e.describe(node) + " ≠ 0"
+	}
+	return e.describe(node) + " > 0"
+}
+
+// Describes the condition that the node is zero or less.
+func (e *explainer) falsity(node *ScriptNode) string {
+	if node.Type == Int {
+		if node.N <= 0 {
+			return "true"
+		}
+		return "false"
+	}
+
+	args := node.Children[1:]
+	switch node.Children[0].Func.Name {
+	case "not":
+		return e.truth(args[0], false)
+	case "<":
+		return e.describe(args[0]) + " ≥ " + e.describe(args[1])
+	case ">":
+		return e.describe(args[0]) + " ≤ " + e.describe(args[1])
+	case "=":
+		if parity := e.parity(args); parity[0] != "" {
+			return parity[0]
+		}
+		return e.describe(args[0]) + " ≠ " + e.describe(args[1])
+	case "and", "or":
+		return "not (" + e.truth(node, false) + ")"
+	}
+	if isZeroOrOne(node) {
+		return "not " + e.predicate(node)
+	}
+	return e.describe(node) + " ≤ 0"
+}
+
+// Wraps a condition in parentheses if it uses the other kind of connective, so that `a and (b or c)` stays clear.
+func (e *explainer) clause(node *ScriptNode, nonZero bool, otherConnective string) string {
+	text := e.truth(node, nonZero)
+	if isCall(node, otherConnective) {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// Describes a function that always returns 0 or 1 as the condition that it returns 1.
+func (e *explainer) predicate(node *ScriptNode) string {
+	if node.Type == Int {
+		return fmt.Sprintf("%d", node.N)
+	}
+	args := node.Children[1:]
+	name := node.Children[0].Func.Name
+	switch name {
+	case "<", ">":
+		return e.describe(args[0]) + " " + name + " " + e.describe(args[1])
+	case "=":
+		if parity := e.parity(args); parity[1] != "" {
+			return parity[1]
+		}
+		return e.describe(args[0]) + " = " + e.describe(args[1])
+	case "can-move?":
+		return "can move " + e.direction(args[0])
+	}
+	if len(args) == 0 {
+		return sensorName(name)
+	}
+	return oneLine(node)
+}
+
+// Spots `(= (mod x 2) 0)` and returns the ways to say that x is odd or even, or "" if it's something else. We leave
+// `(= (mod x 2) 1)` alone, since it isn't true for negative odd numbers.
+func (e *explainer) parity(args []*ScriptNode) [2]string {
+	for i := 0; i < 2; i++ {
+		modulus, remainder := args[i], args[1 - i]
+		if isCall(modulus, "mod") && isInt(modulus.Children[2], 2) && isInt(remainder, 0) {
+			x := e.describe(modulus.Children[1])
+			return [2]string{x + " is odd", x + " is even"}
+		}
+	}
+	return [2]string{}
+}
+
+// Names a direction from the team's point of view.
+func (e *explainer) direction(node *ScriptNode) string {
+	if node.Type == Int {
+		return DIRECTION_NAMES[intAbs(node.N % int(NumberOfDirections))]
+	}
+	if place, found := DIRECTION_SENSORS[node.Children[0].Func.Name]; found {
+		return place
+	}
+	if arg, n := e.arg(node); arg != nil {
+		if e.usesEffectfulArgs(node) {
+			return fmt.Sprintf("in direction argument %d (%s)", n, e.caller.describe(arg))
+		}
+		return e.caller.direction(arg)
+	}
+	return "in direction " + e.describe(node)
+}
+
+// Describes a number in words and ordinary arithmetic.
+func (e *explainer) describe(node *ScriptNode) string {
+	if node.Type == Int {
+		return fmt.Sprintf("%d", node.N)
+	}
+
+	name := node.Children[0].Func.Name
+	args := node.Children[1:]
+	switch {
+	case INFIX_FUNCTIONS[name]:
+		return e.operand(args[0]) + " " + name + " " + e.operand(args[1])
+	case name == "min" || name == "max":
+		return fmt.Sprintf("%s(%s, %s)", name, e.describe(args[0]), e.describe(args[1]))
+	case name == "neg":
+		return "-" + e.operand(args[0])
+	case name == "abs":
+		return "|" + e.describe(args[0]) + "|"
+	case name == "rand":
+		return fmt.Sprintf("random(%s)", e.describe(args[0]))
+	case name == "load":
+		return fmt.Sprintf("memory[%s]", e.describe(args[0]))
+	case name == "store":
+		return fmt.Sprintf("(memory[%s] := %s)", e.describe(args[0]), e.describe(args[1]))
+	case name == "listen":
+		return fmt.Sprintf("channel[%s]", e.describe(args[0]))
+	case name == "broadcast":
+		return fmt.Sprintf("(channel[%s] := %s)", e.describe(args[0]), e.describe(args[1]))
+	case name == "look" || name == "distance":
+		return name + " " + e.direction(args[0])
+	case name == "if":
+		return fmt.Sprintf("(%s if %s, else %s)", e.describe(args[1]), e.truth(args[0], false), e.describe(args[2]))
+	case name == "and" || name == "or" || name == "not" || isZeroOrOne(node):
+		return fmt.Sprintf("(1 if %s, else 0)", e.truth(node, false))
+	}
+	if arg, n := e.arg(node); arg != nil {
+		// The argument is only worked out once per call, so we don't want it to look like a new random number.
+		if e.usesEffectfulArgs(node) {
+			return fmt.Sprintf("argument %d (%s)", n, e.caller.describe(arg))
+		}
+		return e.caller.operand(arg)
+	}
+	if len(args) == 0 {
+		return sensorName(name)
+	}
+	return oneLine(node)
+}
+
+// Most of the sensors read well enough by name, like "enemy visible" or "ticks remaining".
+func sensorName(name string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(name, "?"), "-", " ")
+}
+
+// If the node is one of the current subroutine's arguments, returns the code that it was called with and its number.
+func (e *explainer) arg(node *ScriptNode) (*ScriptNode, int) {
+	var n int
+	if _, err := fmt.Sscanf(node.Children[0].Func.Name, "arg-%d", &n); err != nil || e.caller == nil {
+		return nil, 0
+	}
+	return e.args[n], n
+}
+
+// Describes a number that's part of some arithmetic, with parentheses if it needs them.
+func (e *explainer) operand(node *ScriptNode) string {
+	if node.Type == Expr && INFIX_FUNCTIONS[node.Children[0].Func.Name] {
+		return "(" + e.describe(node) + ")"
+	}
+	return e.describe(node)
+}
+
+// Removes rules that can never be reached, and rules that do the same thing as the rule after them. Conditions only
+// count as the same if they have the same key, so a random number that gets checked twice stays in twice.
+func tidyRules(rules []Rule) []Rule {
+	var reachable []Rule
+	for _, rule := range rules {
+		rule.Conditions = uniqueConditions(rule.Conditions)
+		shadowed := false
+		for _, earlier := range reachable {
+			shadowed = shadowed || containsAll(rule.Conditions, earlier.Conditions)
+		}
+		if !shadowed {
+			reachable = append(reachable, rule)
+		}
+	}
+
+	// If a rule is followed by one with the same action and fewer conditions, the second one would catch everything
+	// that the first one does.
+	for i := len(reachable) - 2; i >= 0; i-- {
+		next := reachable[i + 1]
+		if reachable[i].Action == next.Action && containsAll(reachable[i].Conditions, next.Conditions) {
+			reachable = append(reachable[:i], reachable[i + 1:]...)
+		}
+	}
+	return reachable
+}
+
+func anyCanAct(nodes []*ScriptNode) bool {
+	for _, node := range nodes {
+		if canAct(node) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinConditions(conditions []Condition) string {
+	texts := make([]string, len(conditions))
+	for i, condition := range conditions {
+		texts[i] = condition.Text
+	}
+	return strings.Join(texts, " and ")
+}
+
+func uniqueConditions(list []Condition) []Condition {
+	var unique []Condition
+	for _, c := range list {
+		if !containsAll(unique, []Condition{c}) {
+			unique = append(unique, c)
+		}
+	}
+	return unique
+}
+
+func containsAll(list []Condition, wanted []Condition) bool {
+	for _, w := range wanted {
+		found := false
+		for _, c := range list {
+			found = found || c.key == w.key
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainScript(t *testing.T) {
+	tests := map[string]string{
+		"(if (and (enemy-visible?) (= (mod (tick) 2) 0)) (shoot-nearest) (if (can-move? 0) (move 0) (wait)))":
+			"if enemy visible and tick is even → shoot the nearest enemy\n" +
+			"else if can move north → move north\n" +
+			"otherwise → wait\n",
+		"(move 6)": "always → move east\n",
+		"(+ 1 (tick))": "always → wait\n",
+		"(if (> (tick) (* 2 5)) (shoot (enemy-direction)) 3)":
+			"if tick > 10 → shoot toward the nearest enemy\n" +
+			"otherwise → wait\n",
+		"(if (not (< (load 1) 3)) (move (step-toward-enemy-goal)) (if (not (ally-visible?)) (wait) (move 1)))":
+			"if memory[1] ≥ 3 → move along the path to the enemy goal\n" +
+			"else if not ally visible → wait\n" +
+			"otherwise → move south\n",
+		"(if (or (enemy-visible?) (own-goal-visible?)) (if (> (tick) 5) (shoot-nearest) (move 2)) (move 2))":
+			"if (enemy visible or own goal visible) and tick > 5 → shoot the nearest enemy\n" +
+			"otherwise → move east\n",
+		"(if (enemy-visible?) (if (enemy-visible?) (move 1) (move 2)) (move 3))":
+			"if enemy visible → move south\n" +
+			"otherwise → move west\n",
+		"(if (- (my-x-pos) (abs (listen 2))) (move (+ (tick) 1)) (shoot 3))":
+			"if my x pos - |channel[2]| > 0 → move in direction tick + 1\n" +
+			"otherwise → shoot west\n",
+		"(defun 0 (if (> (arg-0) 3) (move (arg-1)) (shoot-nearest))) (call-0 (+ (tick) 1) (enemy-goal-direction))":
+			"if (tick + 1) > 3 → move toward the enemy goal\n" +
+			"otherwise → shoot the nearest enemy\n",
+		// Each `rand` is a new random number, so the second check isn't the same as the first.
+		"(if (rand 2) (if (rand 2) (move 1) (move 2)) (move 3))":
+			"if random(2) > 0 and random(2) > 0 → move south\n" +
+			"else if random(2) > 0 → move east\n" +
+			"otherwise → move west\n",
+		// But an argument only gets worked out once per call.
+		"(defun 0 (if (arg-0) (if (arg-0) (move 1) (move 2)) (move 3))) (call-0 (rand 2) 0)":
+			"if argument 0 (random(2)) > 0 → move south\n" +
+			"otherwise → move west\n",
+		"(if (tick) (* (if (enemy-visible?) (move 1) 2) 3) (move 2))":
+			"if tick > 0 → whatever (* (if (enemy-visible?) (move 1) 2) 3) does\n" +
+			"otherwise → move east\n",
+	}
+
+	for code, explanation := range tests {
+		assert.Equal(t, explanation, FormatRules(ExplainScript(MustParseScript(code))), code)
+	}
+}
+
+func TestExplainLeavesTreeAlone(t *testing.T) {
+	tree := MustParseScript("(if (enemy-visible?) (move (+ 1 1)) (move 2))")
+	ExplainScript(tree)
+	assert.Equal(t, "(if (enemy-visible?) (move (+ 1 1)) (move 2))", oneLine(tree))
+}
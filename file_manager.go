@@ -17,6 +17,8 @@ type FileManager struct {
 	Scenario string
 	Generation int
 	ScriptIds []int
+	HandWrittenIds []int
+	Hashes map[string]int   // The canonical hash of each generated script, and the first script that had it
 }
 
 type ResultProcessor func(matchId, scriptA, scriptB, scoreA, scoreB, ticks int)
@@ -26,18 +28,31 @@ var scriptIdRegexp = regexp.MustCompile(`/(\d+).l$`)
 var generationRegexp = regexp.MustCompile(`/gen_(\d+)$`)
 
 func NewFileManager(scenario string, generation int) *FileManager {
-	fm := &FileManager{scenario, generation, make([]int, 0, SCRIPTS_PER_GENERATION)}
+	fm := &FileManager{scenario, generation, make([]int, 0, SCRIPTS_PER_GENERATION), []int{}, make(map[string]int)}
 
 	if err := os.MkdirAll(fm.SimpleScriptsDir(), 0755); err != nil {
 		logger.Fatalf("Failed to create directory %s: %v", fm.ScriptsDir(), err)
 	}
 
 	fm.ReadScriptIds()
+	fm.ReadHashes()
 	return fm
 }
 
 func (fm *FileManager) ReadScriptIds() {
-	pattern := fm.ScriptsDir() + "/*.l"
+	fm.ScriptIds = readIdsFromDir(fm.ScriptsDir(), fm.ScriptIds[:0])
+	sort.Ints(fm.ScriptIds)
+
+	// Hand-written scripts get negative IDs so that they can't be confused with generated ones.
+	fm.HandWrittenIds = readIdsFromDir(fm.HandWrittenDir(), fm.HandWrittenIds[:0])
+	for i := range fm.HandWrittenIds {
+		fm.HandWrittenIds[i] = -fm.HandWrittenIds[i]
+	}
+	sort.Ints(fm.HandWrittenIds)
+}
+
+func readIdsFromDir(dir string, ids []int) []int {
+	pattern := dir + "/*.l"
 	filenames, err := filepath.Glob(pattern)
 	if err != nil {
 		logger.Fatalf("Can't glob %s: %v", pattern, err)
@@ -48,9 +63,20 @@ func (fm *FileManager) ReadScriptIds() {
 		if len(submatches) != 2 {
 			logger.Fatalf("Unparseable name in scripts directory: %v", filename)
 		}
-		fm.ScriptIds = append(fm.ScriptIds, strToInt(submatches[1]))
+		ids = append(ids, strToInt(submatches[1]))
 	}
-	sort.Ints(fm.ScriptIds)
+	return ids
+}
+
+// The generated scripts plus any hand-written ones: everything that should play a match in this generation.
+func (fm *FileManager) AllScriptIds() []int {
+	ids := make([]int, 0, len(fm.ScriptIds) + len(fm.HandWrittenIds))
+	ids = append(ids, fm.HandWrittenIds...)
+	return append(ids, fm.ScriptIds...)
+}
+
+func IsHandWritten(id int) bool {
+	return id < 0
 }
 
 func (fm *FileManager) GenerationDir() string {
@@ -72,7 +98,37 @@ func (fm *FileManager) SimpleScriptsDir() string {
 	return fmt.Sprintf("scenario/%s/gen_%d/scripts/simple", fm.Scenario, fm.Generation)
 }
 
-func (fm *FileManager) WriteNewScript(code string) {
+func (fm *FileManager) QuarantineDir() string {
+	return fmt.Sprintf("scenario/%s/gen_%d/scripts/quarantine", fm.Scenario, fm.Generation)
+}
+
+// Scripts that people wrote by hand live outside of the generations, and are used as opponents in every generation.
+// They're loaded exactly as written, so they can have comments and whatever formatting you like.
+func (fm *FileManager) HandWrittenDir() string {
+	return fmt.Sprintf("scenario/%s/hand_written", fm.Scenario)
+}
+
+func (fm *FileManager) ScriptPath(id int) string {
+	if IsHandWritten(id) {
+		return fmt.Sprintf("%s/%d.l", fm.HandWrittenDir(), -id)
+	}
+	return fmt.Sprintf("%s/%d.l", fm.ScriptsDir(), id)
+}
+
+func (fm *FileManager) SimpleScriptPath(id int) string {
+	return fmt.Sprintf("%s/%d.l", fm.SimpleScriptsDir(), id)
+}
+
+// Saves a new script to the generation. The origin says how it was made: "random", "copy", "splice", or the name of
+// the mutation operator.
+func (fm *FileManager) WriteNewScript(code string, origin string) error {
+	tree, err := ParseScript(code)
+	if err != nil {
+		return err
+	}
+	originalSize := tree.Size()
+	hash := ScriptHash(tree)
+
 	highestId := 1
 	if len(fm.ScriptIds) > 0 {
 		highestId = fm.ScriptIds[len(fm.ScriptIds)-1]
@@ -80,19 +136,95 @@ func (fm *FileManager) WriteNewScript(code string) {
 	}
 	fm.ScriptIds = append(fm.ScriptIds, highestId)
 
-	path := fmt.Sprintf("%s/%d.l", fm.ScriptsDir(), highestId)
-	fm.WriteFile(path, code)
+	fm.WriteFile(fm.ScriptPath(highestId), code)
+	fm.recordHash(highestId, hash)
+	fm.appendRow(fm.OriginsPath(), "id,origin", fmt.Sprintf("%d,%s", highestId, origin))
 
-	tree := ParseScript(code)
-	tree2 := ParseScript(code)
-	ts := tree.Size()
-	t2s := tree2.Size()
 	SimplifyTree(tree)
-	if ts < t2s {
-		logger.Printf("Shrunk script %d (%d - %d = %d)", highestId, t2s, ts, t2s - ts)
+	if tree.Size() < originalSize {
+		logger.Printf("Shrunk script %d (%d - %d = %d)", highestId, originalSize, tree.Size(), originalSize - tree.Size())
 	}
-	path = fmt.Sprintf("%s/%d.l", fm.SimpleScriptsDir(), highestId)
-	fm.WriteFile(path, FormatScript(tree))
+	fm.WriteFile(fm.SimpleScriptPath(highestId), FormatScript(tree))
+	return nil
+}
+
+func (fm *FileManager) HashesPath() string {
+	return fmt.Sprintf("%s/hashes.csv", fm.GenerationDir())
+}
+
+// Loads the hashes of the scripts that have already been written, in case we're finishing off a generation that got
+// interrupted.
+func (fm *FileManager) ReadHashes() {
+	contents, err := os.ReadFile(fm.HashesPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	} else if err != nil {
+		logger.Fatalf("Can't read %s: %v", fm.HashesPath(), err)
+	}
+
+	for _, row := range strings.Split(strings.TrimSpace(string(contents)), "\n")[1:] {
+		columns := strings.Split(row, ",")
+		if _, found := fm.Hashes[columns[1]]; !found {
+			fm.Hashes[columns[1]] = strToInt(columns[0])
+		}
+	}
+}
+
+func (fm *FileManager) recordHash(id int, hash string) {
+	fm.appendRow(fm.HashesPath(), "id,hash", fmt.Sprintf("%d,%s", id, hash))
+	if _, found := fm.Hashes[hash]; !found {
+		fm.Hashes[hash] = id
+	}
+}
+
+func (fm *FileManager) OriginsPath() string {
+	return fmt.Sprintf("%s/origins.csv", fm.GenerationDir())
+}
+
+// Adds a row to the end of a CSV file, starting the file with a header if it's new.
+func (fm *FileManager) appendRow(path string, header string, row string) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		logger.Fatalf("Can't open %s: %v", path, err)
+	}
+	defer file.Close()
+	if stat, err := file.Stat(); err == nil && stat.Size() == 0 {
+		file.WriteString(header + "\n")
+	}
+	file.WriteString(row + "\n")
+}
+
+// Returns true if we've already written a script that's equivalent to this one.
+func (fm *FileManager) IsDuplicate(tree *ScriptNode) bool {
+	_, found := fm.Hashes[ScriptHash(tree)]
+	return found
+}
+
+// Moves a script that we can't use out of the scripts directory so that it won't be picked for any matches. We leave
+// hand-written scripts where they are, since somebody's presumably still working on them, and just ignore them.
+func (fm *FileManager) QuarantineScript(id int) {
+	if IsHandWritten(id) {
+		fm.HandWrittenIds = removeId(fm.HandWrittenIds, id)
+		return
+	}
+
+	if err := os.MkdirAll(fm.QuarantineDir(), 0755); err != nil {
+		logger.Fatalf("Failed to create directory %s: %v", fm.QuarantineDir(), err)
+	}
+	destination := fmt.Sprintf("%s/%d.l", fm.QuarantineDir(), id)
+	if err := os.Rename(fm.ScriptPath(id), destination); err != nil {
+		logger.Fatalf("Couldn't move %s to %s: %v", fm.ScriptPath(id), destination, err)
+	}
+	fm.ScriptIds = removeId(fm.ScriptIds, id)
+}
+
+func removeId(ids []int, id int) []int {
+	for i, existing := range ids {
+		if existing == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
 }
 
 func (fm *FileManager) WriteFile(path string, contents string) {
@@ -105,7 +237,7 @@ func (fm *FileManager) WriteFile(path string, contents string) {
 }
 
 func (fm *FileManager) ScriptCode(id int) string {
-	path := fmt.Sprintf("%s/%d.l", fm.ScriptsDir(), id)
+	path := fm.ScriptPath(id)
 	source, err := os.ReadFile(path)
 	if err != nil {
 		logger.Fatalf("Couldn't read script %s: %v", path, err)
@@ -127,9 +259,23 @@ func (fm *FileManager) AverageScriptSize() int {
 	return sum / len(fm.ScriptIds)
 }
 
-func (fm *FileManager) LoadScript(state *GameState, id int) Script {
-	source := fm.ScriptCode(id)
-	return Script{ParseScript(source), state}
+// Measures the size and depth of the generation's scripts. Scripts that don't parse are left out.
+func (fm *FileManager) TreeShapes() ShapeStats {
+	trees := make([]*ScriptNode, 0, len(fm.ScriptIds))
+	for _, id := range fm.ScriptIds {
+		if tree, err := ParseScript(fm.ScriptCode(id)); err == nil {
+			trees = append(trees, tree)
+		}
+	}
+	return MeasureShapes(trees)
+}
+
+func (fm *FileManager) LoadScript(state *GameState, id int) (Script, error) {
+	tree, err := ParseTypedScript(fm.ScriptCode(id))
+	if err != nil {
+		return Script{}, fmt.Errorf("%s: %w", fm.ScriptPath(id), err)
+	}
+	return NewScript(tree, state), nil
 }
 
 // X,Y (1 byte each), then moves, shots, kills, waits at 4 bytes each. Actual size will be packed smaller.
@@ -152,19 +298,43 @@ func (fm *FileManager) WriteCellStatistics(arena *Arena) {
 	}
 }
 
+// Records every blackboard write from a visualized match, in the order they happened.
+func (fm *FileManager) WriteBroadcasts(broadcasts []Broadcast) {
+	path := fmt.Sprintf("%s/broadcasts.csv", fm.GenerationDir())
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		logger.Fatalf("Couldn't open %s for writing: %v", path, err)
+	}
+	defer file.Close()
+
+	file.WriteString("tick,bot,team,channel,value\n")
+	for _, b := range broadcasts {
+		file.WriteString(fmt.Sprintf("%d,%d,%d,%d,%d\n", b.Tick, b.BotId, b.Team, b.Channel, b.Value))
+	}
+}
+
+// Records which parts of each bot's script ran on each tick of a visualized match.
+func (fm *FileManager) WriteTraces(matchId int, tracer *Tracer) {
+	path := fmt.Sprintf("%s/trace_%d.csv", fm.GenerationDir(), matchId)
+	if err := os.WriteFile(path, []byte(tracer.FormatCSV()), 0644); err != nil {
+		logger.Fatalf("Couldn't write %s: %v", path, err)
+	}
+}
+
 func (fm *FileManager) WriteMatchOutcome(match *Match) {
 	path := fmt.Sprintf("scenario/%s/gen_%d/results.csv", fm.Scenario, fm.Generation)
 
 	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 	stat, err := file.Stat()
 	if (err != nil && errors.Is(err, fs.ErrNotExist)) || stat.Size() == 0 {
-		file.WriteString("matchId,scriptA,scriptB,scoreA,scoreB,ticks\n")
+		file.WriteString("matchId,scriptA,scriptB,scoreA,scoreB,ticks,overBudgetA,overBudgetB\n")
 	} else if err != nil {
 		logger.Fatalf("Can't stat %s: %v", path, err)
 	}
 
-	row := fmt.Sprintf("%d,%d,%d,%d,%d,%d\n", match.Id, match.ScriptA, match.ScriptB,
-											match.Scores[TeamA], match.Scores[TeamB], match.State.Tick)
+	row := fmt.Sprintf("%d,%d,%d,%d,%d,%d,%d,%d\n", match.Id, match.ScriptA, match.ScriptB,
+											match.State.Scores[TeamA], match.State.Scores[TeamB], match.State.Tick,
+											match.OverBudgetTicks[TeamA], match.OverBudgetTicks[TeamB])
 	written, err := file.WriteString(row)
 	if err != nil {
 		logger.Fatalf("Couldn't write %d characters to %s: %v", len(row), path, err)
@@ -235,15 +405,17 @@ func (fm *FileManager) EachCellRow(callback CellProcessor) {
 }
 
 func (fm *FileManager) FindScriptIds(matchId int) (int, int) {
-	scriptA, scriptB := -1, -1
+	scriptA, scriptB := 0, 0
+	found := false
 
 	fm.EachResultRow(func (m, a, b, _, _, _ int) {
 		if m == matchId {
 			scriptA, scriptB = a, b
+			found = true
 		}
 	})
 
-	if scriptA < 0 || scriptB < 0 {
+	if !found {
 		logger.Fatalf("Can't find a match in generation %d with id %d!", fm.Generation, matchId)
 	}
 	return scriptA, scriptB
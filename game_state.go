@@ -1,11 +1,31 @@
 package main
 
+import (
+	"math/rand"
+)
+
+// The number of channels on each team's blackboard.
+const BLACKBOARD_CHANNELS = 8
+
 type GameState struct {
 	Arena *Arena
 	Bots []Bot
 	Goals [2]Goal
 	CurrentBot *Bot
 	Tick int
+	Scores [2]int
+	Blackboards [2][BLACKBOARD_CHANNELS]int
+	Broadcasts []Broadcast   // The broadcasts made during the current bot's turn, for the visualizer's benefit.
+	Rand *rand.Rand          // Shared with the match, so that scripts' random numbers are reproducible too.
+}
+
+// A record of a bot writing a value to its team's blackboard.
+type Broadcast struct {
+	Tick int
+	BotId int
+	Team Team
+	Channel int
+	Value int
 }
 
 func NewGameState(arena *Arena) *GameState {
@@ -30,7 +50,7 @@ func NewGameState(arena *Arena) *GameState {
 }
 
 func NewEmptyGameState(arena *Arena) *GameState {
-	state := &GameState{arena, []Bot{}, [2]Goal{}, nil, 0}
+	state := &GameState{arena, []Bot{}, [2]Goal{}, nil, 0, [2]int{0, 0}, [2][BLACKBOARD_CHANNELS]int{}, []Broadcast{}, rand.New(rand.NewSource(0))}
 	state.Goals[TeamA] = Goal{Team: TeamA, Position: arena.Goals[TeamA], Alive: true}
 	state.Goals[TeamB] = Goal{Team: TeamB, Position: arena.Goals[TeamB], Alive: true}
 	return state
@@ -68,13 +88,49 @@ func (gs *GameState) FirstNonEmptyCellOnLine(src *Cell, dest *Cell) *Cell {
 	return found
 }
 
-func (gs *GameState) NearestVisibleEnemyOrGoal() *Cell {
+// The things that a bot can see when it looks in a direction.
+const (
+	LookWall = iota
+	LookAlly
+	LookEnemy
+	LookOwnGoal
+	LookEnemyGoal
+)
+
+// Finds the first thing in a straight line from the current bot in the given absolute direction, and returns what it
+// is (one of the Look* constants) and how many cells away it is. The edge of the map counts as a wall.
+func (gs *GameState) Look(dir Direction) (int, int) {
+	pos := gs.CurrentBot.Position
+	edge := gs.Arena.EdgeCell(pos, dir)
+	found := gs.FirstNonEmptyCellOnLine(pos, edge)
+	if found == nil {
+		return LookWall, gs.Arena.Distance(pos, edge) + 1
+	}
+
+	distance := gs.Arena.Distance(pos, found)
+	if bot := gs.BotAtCell(found); bot != nil {
+		if bot.Team == gs.CurrentTeam() {
+			return LookAlly, distance
+		}
+		return LookEnemy, distance
+	}
+	if goal := gs.GoalAtCell(found); goal != nil {
+		if goal.Team == gs.CurrentTeam() {
+			return LookOwnGoal, distance
+		}
+		return LookEnemyGoal, distance
+	}
+	return LookWall, distance
+}
+
+// Finds the closest living bot on the given team that the current bot can see, not counting the current bot itself.
+func (gs *GameState) NearestVisibleBot(team Team) *Cell {
 	closestDistance := gs.Arena.Width * 100
 	var closestTarget *Cell = nil
 
 	for i := range gs.Bots {
 		bot := &gs.Bots[i]
-		if gs.CurrentTeam() != bot.Team && bot.Alive && gs.Arena.CanSee(gs.CurrentBot.Position, bot.Position) {
+		if team == bot.Team && bot.Alive && bot != gs.CurrentBot && gs.Arena.CanSee(gs.CurrentBot.Position, bot.Position) {
 			distance := gs.Arena.Distance(gs.CurrentBot.Position, bot.Position)
 			if distance < closestDistance {
 				closestDistance = distance
@@ -82,15 +138,39 @@ func (gs *GameState) NearestVisibleEnemyOrGoal() *Cell {
 			}
 		}
 	}
+	return closestTarget
+}
 
-	for i := range gs.Goals {
-		goal := &gs.Goals[i]
-		if gs.CurrentTeam() != goal.Team && goal.Alive && gs.Arena.CanSee(gs.CurrentBot.Position, goal.Position) {
-			distance := gs.Arena.Distance(gs.CurrentBot.Position, goal.Position)
-			if distance < closestDistance {
-				closestDistance = distance
-				closestTarget = goal.Position
-			}
+// Returns the team-relative direction of the next step along the shortest path from the current bot to the given
+// team's goal, and false if there's no path. Ties go to the lowest-numbered relative direction so that both teams
+// behave the same way.
+func (gs *GameState) StepTowardGoal(goalTeam Team) (Direction, bool) {
+	position := gs.CurrentBot.Position
+	goal := gs.Arena.Goals[goalTeam]
+	if gs.Arena.Distance(position, goal) == 1 {
+		return absoluteToRelativeDirection(gs.Arena.DirectionTo(position, goal), gs.CurrentTeam()), true
+	}
+
+	bestDir, bestDistance := North, gs.Arena.PathDistance(position, goalTeam)
+	found := false
+	for dir := North; dir < NumberOfDirections; dir++ {
+		next := gs.Arena.DestinationCellAfterMove(position, relativeToAbsoluteDirection(dir, gs.CurrentTeam()))
+		distance := gs.Arena.PathDistance(next, goalTeam)
+		if next != position && distance >= 0 && distance < bestDistance {
+			bestDir, bestDistance = dir, distance
+			found = true
+		}
+	}
+	return bestDir, found
+}
+
+func (gs *GameState) NearestVisibleEnemyOrGoal() *Cell {
+	closestTarget := gs.NearestVisibleBot(gs.OpposingTeam())
+
+	goal := &gs.Goals[gs.OpposingTeam()]
+	if goal.Alive && gs.Arena.CanSee(gs.CurrentBot.Position, goal.Position) {
+		if closestTarget == nil || gs.Arena.Distance(gs.CurrentBot.Position, goal.Position) < gs.Arena.Distance(gs.CurrentBot.Position, closestTarget) {
+			closestTarget = goal.Position
 		}
 	}
 
@@ -108,6 +188,18 @@ func (gs *GameState) OpposingTeam() Team {
 	return TeamA
 }
 
+// The number of living bots on the given team, not counting the current bot.
+func (gs *GameState) CountLivingBots(team Team) int {
+	count := 0
+	for i := range gs.Bots {
+		bot := &gs.Bots[i]
+		if team == bot.Team && bot.Alive && bot != gs.CurrentBot {
+			count++
+		}
+	}
+	return count
+}
+
 func (gs *GameState) CountVisibleEntities(team Team) int {
 	count := 0
 
@@ -143,6 +235,17 @@ func (gs *GameState) GoalVisible(team Team) bool {
 	return false
 }
 
+// Bots run in turnSequence order, so a bot always sees the broadcasts of every teammate that moved before it on this
+// tick, and of every teammate that moved after it on the previous tick.
+func (gs *GameState) Broadcast(channel, value int) {
+	gs.Blackboards[gs.CurrentTeam()][channel] = value
+	gs.Broadcasts = append(gs.Broadcasts, Broadcast{gs.Tick, gs.CurrentBot.Id, gs.CurrentTeam(), channel, value})
+}
+
+func (gs *GameState) Listen(channel int) int {
+	return gs.Blackboards[gs.CurrentTeam()][channel]
+}
+
 func (gs *GameState) CellIsEmpty(cell *Cell) bool {
 	return cell.BotsCanPass() && gs.BotAtCell(cell) == nil
 }
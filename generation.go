@@ -3,6 +3,7 @@
 package main
 
 import (
+	"fmt"
 	"math/rand"
 	"sort"
 )
@@ -14,6 +15,10 @@ type Generation struct {
 	Arena *Arena
 	Visualizer Visualizer
 	matchups [][2]int   // A list of [scriptA, scriptB] pairs.
+	rejected int        // The number of useless scripts we've thrown away while making this generation.
+	made int            // The number of new scripts we've made for this generation, including ones we threw away.
+	duplicates int      // How many of those were equivalent to a script that was already in the generation.
+	kept int            // Random scripts we kept even though the scenario rejects them, because we couldn't do better.
 }
 
 const SCRIPTS_PER_GENERATION = 10000
@@ -24,6 +29,10 @@ const RANDOM_PERCENT = 0.35
 const MUTATE_PERCENT = 0.30
 const SPLICE_PERCENT = 0.35
 
+// How many times we'll try to replace a useless or duplicate script before giving up. Mutated and spliced scripts get
+// replaced by a random one; random ones just get kept.
+const MAX_REMAKE_ATTEMPTS = 10
+
 func NewHighestGeneration(scenario string, arena *Arena) *Generation {
 	highestGeneration := CurrentHighestGeneration(scenario)
 	return NewGeneration(scenario, highestGeneration + 1, arena)
@@ -32,11 +41,11 @@ func NewHighestGeneration(scenario string, arena *Arena) *Generation {
 func NewGeneration(scenario string, id int, arena *Arena) *Generation {
 	var previous *Generation = nil
 	if id > 1 {
-		previous = &Generation{id - 1, nil, NewFileManager(scenario, id - 1), arena, nil, [][2]int{}}
+		previous = &Generation{id - 1, nil, NewFileManager(scenario, id - 1), arena, nil, [][2]int{}, 0, 0, 0, 0}
 	}
 
 	fileManager := NewFileManager(scenario, id)
-	return &Generation{id, previous, fileManager, arena, nil, [][2]int{}}
+	return &Generation{id, previous, fileManager, arena, nil, [][2]int{}, 0, 0, 0, 0}
 }
 
 	func (g *Generation) Initialize(vis Visualizer) {
@@ -44,7 +53,8 @@ func NewGeneration(scenario string, id int, arena *Arena) *Generation {
 
 	// Ensure that we have a minimum number of scripts in the scripts folder.
 	g.FileManager.ReadScriptIds()
-	if len(g.FileManager.ScriptIds) < SCRIPTS_PER_GENERATION {
+	madeScripts := len(g.FileManager.ScriptIds) < SCRIPTS_PER_GENERATION
+	if madeScripts {
 		if g.Previous == nil {
 				logger.Printf("Gen %d: Creating %d new random scripts", g.Id, SCRIPTS_PER_GENERATION)
 				for i := 0; i < SCRIPTS_PER_GENERATION; i++ {
@@ -56,7 +66,7 @@ func NewGeneration(scenario string, id int, arena *Arena) *Generation {
 
 			logger.Printf("Gen %d: Copying the %d best scripts from generation %d", g.Id, len(best), g.Previous.Id)
 			for count = 0; count < len(best); count++ {
-				g.CopyScriptFromPreviousGen(best[count])
+				g.replaceIfBroken(g.CopyScriptFromPreviousGen(best[count]))
 				count++
 			}
 			logger.Printf("Gen %d: Mangling %d scripts", g.Id, SCRIPTS_PER_GENERATION - count)
@@ -65,16 +75,58 @@ func NewGeneration(scenario string, id int, arena *Arena) *Generation {
 				if n < RANDOM_PERCENT {
 					g.MakeNewRandomScript()
 				} else if n < RANDOM_PERCENT + MUTATE_PERCENT {
-					g.MutateScript(best[rand.Intn(len(best))])
+					g.replaceIfBroken(g.MutateScript(best[rand.Intn(len(best))]))
 				} else {
-					g.SpliceScripts(best[rand.Intn(len(best))], best[rand.Intn(len(best))])
+					g.replaceIfBroken(g.SpliceScripts(best[rand.Intn(len(best))], best[rand.Intn(len(best))]))
 				}
 			}
 		}
+		if g.rejected > 0 {
+			logger.Printf("Gen %d: Threw away %d useless scripts", g.Id, g.rejected)
+		}
+		if g.kept > 0 {
+			logger.Printf("Gen %d: Kept %d random scripts that should have been thrown away, since we couldn't make " +
+			              "acceptable ones", g.Id, g.kept)
+		}
+		if g.made > 0 {
+			logger.Printf("Gen %d: %d of %d new scripts were duplicates (%.1f%%)", g.Id, g.duplicates, g.made,
+			              100.0 * float64(g.duplicates) / float64(g.made))
+		}
 	}
 
 	g.FileManager.ReadScriptIds()
-	g.calculateMatchups(g.FileManager.ScriptIds, MATCHES_PER_SCRIPT)
+	g.quarantineBrokenScripts()
+	if madeScripts {
+		// Measuring means parsing every script again, so we don't bother when we're just looking at an old generation.
+		shapes := g.FileManager.TreeShapes()
+		logger.Printf("Gen %d: Average script size is %.1f expressions, and average depth is %.1f", g.Id,
+		              shapes.AverageSize, shapes.AverageDepth)
+	}
+	g.calculateMatchups(g.FileManager.AllScriptIds(), MATCHES_PER_SCRIPT)
+}
+
+// If a script from the previous generation was broken, we make a random one in its place so that we still end up
+// with a full generation.
+func (g *Generation) replaceIfBroken(err error) {
+	if err != nil {
+		logger.Printf("Gen %d: Making a random script instead of a broken one: %v", g.Id, err)
+		g.MakeNewRandomScript()
+	}
+}
+
+// Somebody might have hand-edited a script and broken it. Rather than killing the whole run, we move it aside and
+// carry on without it.
+func (g *Generation) quarantineBrokenScripts() {
+	for _, id := range g.FileManager.AllScriptIds() {
+		if _, err := ParseTypedScript(g.FileManager.ScriptCode(id)); err != nil {
+			if IsHandWritten(id) {
+				logger.Printf("Gen %d: Ignoring hand-written script %s: %v", g.Id, g.FileManager.ScriptPath(id), err)
+			} else {
+				logger.Printf("Gen %d: Quarantining script %s: %v", g.Id, g.FileManager.ScriptPath(id), err)
+			}
+			g.FileManager.QuarantineScript(id)
+		}
+	}
 }
 
 // Populate some record-keeping data structures that we use to track which scripts will play each other.
@@ -113,24 +165,86 @@ func (g *Generation) calculateMatchups(scriptIds []int, matchesPerScript int) {
 	}
 }
 
-func (g *Generation) CopyScriptFromPreviousGen(scriptId int) {
+func (g *Generation) CopyScriptFromPreviousGen(scriptId int) error {
 	code := g.Previous.FileManager.ScriptCode(scriptId)
-	g.FileManager.WriteNewScript(code)
+	if err := g.FileManager.WriteNewScript(code, "copy"); err != nil {
+		return fmt.Errorf("%s: %w", g.Previous.FileManager.ScriptPath(scriptId), err)
+	}
+	return nil
 }
 
 func (g *Generation) MakeNewRandomScript() {
-	code := RandomScript(MIN_EXPRS_PER_SCRIPT)
-	g.FileManager.WriteNewScript(code)
+	code := NewRandomScript()
+	for attempt := 1; g.shouldReject(code); attempt++ {
+		if attempt == MAX_REMAKE_ATTEMPTS {
+			// Some scenarios can hardly make anything but useless scripts, and we don't want to wait forever.
+			g.kept++
+			break
+		}
+		code = NewRandomScript()
+	}
+	if err := g.FileManager.WriteNewScript(code, "random"); err != nil {
+		logger.Fatalf("Generated an unparseable script: %v\n%s", err, code)
+	}
+}
+
+func (g *Generation) MutateScript(scriptId int) error {
+	return g.writeChangedScript(func() (string, string, error) {
+		code, operator, err := MutateScript(g.Previous.FileManager.ScriptCode(scriptId))
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", g.Previous.FileManager.ScriptPath(scriptId), err)
+		}
+		return code, operator.String(), nil
+	})
 }
 
-func (g *Generation) MutateScript(scriptId int) {
-	code := MutateScript(g.Previous.FileManager.ScriptCode(scriptId))
-	g.FileManager.WriteNewScript(code)
+func (g *Generation) SpliceScripts(scriptA, scriptB int) error {
+	return g.writeChangedScript(func() (string, string, error) {
+		codeA, codeB := g.Previous.FileManager.ScriptCode(scriptA), g.Previous.FileManager.ScriptCode(scriptB)
+		code, err := SpliceScripts(codeA, codeB)
+		if err != nil {
+			return "", "", fmt.Errorf("splicing %s and %s: %w", g.Previous.FileManager.ScriptPath(scriptA),
+			                      g.Previous.FileManager.ScriptPath(scriptB), err)
+		}
+		return code, "splice", nil
+	})
 }
 
-func (g *Generation) SpliceScripts(scriptA, scriptB int) {
-	code := SpliceScripts(g.Previous.FileManager.ScriptCode(scriptA), g.Previous.FileManager.ScriptCode(scriptB))
-	g.FileManager.WriteNewScript(code)
+// Writes a script made by `change`, which also returns how it made it. If the scenario rejects useless or duplicate
+// scripts, we keep trying until we get one that's acceptable, and if that doesn't work, we make a random one instead.
+func (g *Generation) writeChangedScript(change func() (string, string, error)) error {
+	for attempt := 0; attempt < MAX_REMAKE_ATTEMPTS; attempt++ {
+		code, origin, err := change()
+		if err != nil {
+			return err
+		}
+		if !g.shouldReject(code) {
+			return g.FileManager.WriteNewScript(code, origin)
+		}
+	}
+	g.MakeNewRandomScript()
+	return nil
+}
+
+// Returns true if we should throw this script away and make another one: that is, if the scenario rejects useless
+// scripts and the linter thinks that this is one, or if it rejects duplicates and this is one. We count the
+// duplicates either way.
+func (g *Generation) shouldReject(code string) bool {
+	tree, err := ParseScript(code)
+	if err != nil {
+		return false   // WriteNewScript will complain about this.
+	}
+	if CurrentConfig.RejectDegenerateScripts && IsDegenerate(LintScript(tree)) {
+		g.rejected++
+		return true
+	}
+
+	g.made++
+	if g.FileManager.IsDuplicate(tree) {
+		g.duplicates++
+		return CurrentConfig.RejectDuplicateScripts
+	}
+	return false
 }
 
 type ScriptScore struct {
@@ -140,36 +254,65 @@ type ScriptScore struct {
 	Count int
 }
 
-// Returns the IDs of the top-scoring KEEP_PERCENT scripts.
+// Returns the top-scoring KEEP_PERCENT of the generated scripts, along with any hand-written ones that scored as well
+// as them.
 func (g *Generation) BestScores() []ScriptScore {
-	scores := make([]ScriptScore, len(g.FileManager.ScriptIds))
-
+	// Script IDs can have gaps in them if any were quarantined, and hand-written ones are negative, so we can't just
+	// index an array by ID.
+	scoresById := make(map[int]*ScriptScore, len(g.FileManager.ScriptIds))
+	addScore := func(id, score int) {
+		if scoresById[id] == nil {
+			scoresById[id] = &ScriptScore{Id: id}
+		}
+		scoresById[id].Sum += score
+		scoresById[id].Count++
+	}
 	g.FileManager.EachResultRow(func (matchId, scriptA, scriptB, scoreA, scoreB, ticks int) {
-		scores[scriptA - 1].Id = scriptA
-		scores[scriptA - 1].Sum += scoreA
-		scores[scriptA - 1].Count++
-		scores[scriptB - 1].Id = scriptB
-		scores[scriptB - 1].Sum += scoreB
-		scores[scriptB - 1].Count++
+		addScore(scriptA, scoreA)
+		addScore(scriptB, scoreB)
 	})
 
-	for i := range scores {
-		scores[i].Score = float64(scores[i].Sum) / float64(scores[i].Count)
+	scores := make([]ScriptScore, 0, len(scoresById))
+	for _, score := range scoresById {
+		score.Score = float64(score.Sum) / float64(score.Count)
+		scores = append(scores, *score)
 	}
 	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score == scores[j].Score {
+			return scores[i].Id < scores[j].Id
+		}
 		return scores[i].Score > scores[j].Score   // Sorts in reverse order so the best scripts are first
 	})
 
-	elements_to_keep := int(float64(len(scores)) * KEEP_PERCENT)
-	return scores[0:elements_to_keep]
+	// Hand-written scripts don't count toward the cutoff, or a few good ones would leave us with fewer parents.
+	generated := 0
+	for _, score := range scores {
+		if !IsHandWritten(score.Id) {
+			generated++
+		}
+	}
+	elements_to_keep, kept := int(float64(generated) * KEEP_PERCENT), 0
+	for i, score := range scores {
+		if kept == elements_to_keep {
+			return scores[0:i]
+		}
+		if !IsHandWritten(score.Id) {
+			kept++
+		}
+	}
+	return scores
 }
 
+// Returns the IDs of the best generated scripts, which will be the parents of the next generation. Hand-written scripts
+// are only there as opponents, so they don't get to breed.
 func (g *Generation) BestScoreIds() []int {
 	scores := g.BestScores()
-	ids := make([]int, len(scores))
+	ids := make([]int, 0, len(scores))
 
 	for i := 0; i < len(scores); i++ {
-		ids[i] = scores[i].Id
+		if !IsHandWritten(scores[i].Id) {
+			ids = append(ids, scores[i].Id)
+		}
 	}
 	return ids
 }
@@ -182,10 +325,14 @@ func (g *Generation) Run() {
 		if done {
 			break
 		}
-		match := NewMatch(g, matchId, scriptA, scriptB)
+		match, err := NewMatch(g, matchId, scriptA, scriptB)
+		if err != nil {
+			logger.Printf("Gen %d: Skipping match %d: %v", g.Id, matchId, err)
+			continue
+		}
 		match.Run()
 
-		// logger.Printf("[Gen %d, match %d] script %d: %d points, script %d: %d points", g.Id, matchId, scriptA, match.Scores[TeamA], scriptB, match.Scores[TeamB])
+		// logger.Printf("[Gen %d, match %d] script %d: %d points, script %d: %d points", g.Id, matchId, scriptA, match.State.Scores[TeamA], scriptB, match.State.Scores[TeamB])
 		g.FileManager.WriteMatchOutcome(match)
 	}
 	g.FileManager.WriteCellStatistics(g.Arena)
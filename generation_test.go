@@ -1,13 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCalculateMatchups(t *testing.T) {
-	g := &Generation{1, nil, nil, nil, nil, [][2]int{}}
+	g := &Generation{1, nil, nil, nil, nil, [][2]int{}, 0, 0, 0, 0}
 	scriptIds := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
 	matchesPerScript := 5
 	matchCounts := make(map[int]int, len(scriptIds))
@@ -24,3 +26,81 @@ func TestCalculateMatchups(t *testing.T) {
 		assert.True(t, count == matchesPerScript || count == matchesPerScript + 1)
 	}
 }
+
+// Scenarios live in the current directory, so tests that write them have to move somewhere else first.
+func inTempDir(t *testing.T) {
+	dir, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(dir) })
+}
+
+func TestQuarantineBrokenScripts(t *testing.T) {
+	inTempDir(t)
+	fm := NewFileManager("quarantine", 1)
+	assert.NoError(t, os.WriteFile(fm.ScriptPath(1), []byte("(shoot-nearest)\n"), 0644))
+	assert.NoError(t, os.WriteFile(fm.ScriptPath(2), []byte("tick\n"), 0644))
+	assert.NoError(t, os.WriteFile(fm.ScriptPath(3), []byte("(move\n"), 0644))
+	fm.ReadScriptIds()
+
+	g := &Generation{1, nil, fm, nil, nil, [][2]int{}, 0, 0, 0, 0}
+	g.quarantineBrokenScripts()
+	assert.Equal(t, []int{1}, fm.ScriptIds)
+	for _, id := range []int{2, 3} {
+		assert.FileExists(t, fmt.Sprintf("%s/%d.l", fm.QuarantineDir(), id))
+		assert.NoFileExists(t, fm.ScriptPath(id))
+	}
+}
+
+func TestRandomScriptsGiveUpOnRejection(t *testing.T) {
+	inTempDir(t)
+	// Every script that this can make always shoots the nearest enemy, so the linter says they're all useless.
+	assert.NoError(t, withScenarioConfig(t, func(config *ScenarioConfig) {
+		config.FunctionWeights = map[string]float64{"shoot-nearest": 1, "enemy-visible?": 1}
+		config.RejectDegenerateScripts, config.Initialization = true, "grow"
+	}))
+
+	g := NewGeneration("rejection", 1, nil)
+	g.MakeNewRandomScript()
+	g.FileManager.ReadScriptIds()
+	assert.Len(t, g.FileManager.ScriptIds, 1)
+	assert.Equal(t, 1, g.kept)
+	assert.Equal(t, MAX_REMAKE_ATTEMPTS, g.rejected)
+}
+
+func TestRandomScriptsGiveUpOnDuplicates(t *testing.T) {
+	inTempDir(t)
+	// With only these functions at this depth, every script simplifies down to the same thing.
+	assert.NoError(t, withScenarioConfig(t, func(config *ScenarioConfig) {
+		config.FunctionWeights = map[string]float64{"shoot-nearest": 1, "enemy-visible?": 1}
+		config.RejectDuplicateScripts = true
+		config.Initialization, config.MinInitialDepth, config.MaxInitialDepth = "full", 2, 2
+	}))
+
+	g := NewGeneration("duplicates", 1, nil)
+	for i := 0; i < 5; i++ {
+		g.MakeNewRandomScript()
+	}
+	g.FileManager.ReadScriptIds()
+	assert.Len(t, g.FileManager.ScriptIds, 5)
+	assert.Equal(t, 4, g.kept)
+	assert.Equal(t, 4 * MAX_REMAKE_ATTEMPTS, g.duplicates)
+}
+
+func TestHandWrittenScriptsDontTakeParentSlots(t *testing.T) {
+	inTempDir(t)
+	fm := NewFileManager("best", 1)
+	results := "matchId,scriptA,scriptB,scoreA,scoreB,ticks,overBudgetA,overBudgetB\n" +
+	           "0,-1,1,100,0,50,0,0\n1,-2,2,90,0,50,0,0\n2,3,4,50,40,50,0,0\n" +
+	           "3,5,6,30,20,50,0,0\n4,7,8,10,5,50,0,0\n5,9,10,3,2,50,0,0\n"
+	assert.NoError(t, os.WriteFile(fm.GenerationDir() + "/results.csv", []byte(results), 0644))
+
+	// The two hand-written scripts beat everything, but 20% of the ten generated scripts still get to breed.
+	g := &Generation{1, nil, fm, nil, nil, [][2]int{}, 0, 0, 0, 0}
+	ids := []int{}
+	for _, score := range g.BestScores() {
+		ids = append(ids, score.Id)
+	}
+	assert.Equal(t, []int{-1, -2, 3, 4}, ids)
+	assert.Equal(t, []int{3, 4}, g.BestScoreIds())
+}
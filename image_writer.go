@@ -18,16 +18,20 @@ type ImageWriter struct {
 	Prefix string
 	NextFileIndex int
 	PixelsPerCell int
+	PanelHeight int  // Extra pixels below the arena for the trace panel. See DrawTrace.
 	CurrentImage *ArenaImage
 }
 
+// Each expression in the trace panel is a square this many pixels wide.
+const TRACE_PIXELS_PER_NODE = 4
+
 func NewImageWriter(prefix string, pixelsPerCell int) ImageWriter {
 	dir := fmt.Sprintf("/tmp/robot-arena-%d-%d", os.Getpid(), time.Now().UnixNano())
 	if err := os.Mkdir(dir, 0755); err != nil {
 		logger.Fatalf("Could not create temporary directory %s: %v", dir, err)
 	}
 
-	return ImageWriter{dir, prefix, 0, pixelsPerCell, nil}
+	return ImageWriter{dir, prefix, 0, pixelsPerCell, 0, nil}
 }
 
 // The names have to be lexicographically sorted so that they're assembled in the right order.
@@ -49,7 +53,13 @@ func (writer *ImageWriter) WriteImage(state *GameState, action *Action) {
 }
 
 func (writer *ImageWriter) StartImage(arena *Arena) {
-	writer.CurrentImage = NewArenaImage(writer.NextFileName(), arena.Width, arena.Height, writer.PixelsPerCell)
+	writer.CurrentImage = NewArenaImage(writer.NextFileName(), arena.Width, arena.Height, writer.PixelsPerCell,
+	                                    writer.PanelHeight)
+	if writer.PanelHeight > 0 {
+		panel := image.Rect(0, arena.Height * writer.PixelsPerCell, arena.Width * writer.PixelsPerCell,
+		                    arena.Height * writer.PixelsPerCell + writer.PanelHeight)
+		writer.CurrentImage.DrawRect(panel, color.RGBA{255, 255, 255, 255}) // white
+	}
 
 	// Draw the map
 	for x := 0; x < writer.CurrentImage.Width; x++ {
@@ -110,6 +120,43 @@ func (writer *ImageWriter) DrawGameState(state *GameState, action *Action) {
 	}
 }
 
+// Reserves enough room below the arena for the trace panel of a script with this many expressions.
+func (writer *ImageWriter) ReserveTracePanel(arena *Arena, maxSize int) {
+	nodesPerRow := arena.Width * writer.PixelsPerCell / TRACE_PIXELS_PER_NODE
+	writer.PanelHeight = (maxSize + nodesPerRow - 1) / nodesPerRow * TRACE_PIXELS_PER_NODE
+}
+
+// Shows which parts of the current bot's script ran on its turn. The bot gets a yellow outline, and the panel below
+// the arena has a square for each expression in its script, in the order that the trace numbers them: grey if it
+// didn't run, and the bot's team color if it did.
+func (writer *ImageWriter) DrawTrace(state *GameState, tracer *Tracer, trace BotTrace) {
+	bot := state.CurrentBot
+	left, top := bot.Position.X * writer.PixelsPerCell, bot.Position.Y * writer.PixelsPerCell
+	right, bottom := left + writer.PixelsPerCell, top + writer.PixelsPerCell
+	outline := color.RGBA{255, 200, 0, 255} // yellow
+	writer.CurrentImage.DrawRect(image.Rect(left, top, right, top + 2), outline)
+	writer.CurrentImage.DrawRect(image.Rect(left, bottom - 2, right, bottom), outline)
+	writer.CurrentImage.DrawRect(image.Rect(left, top, left + 2, bottom), outline)
+	writer.CurrentImage.DrawRect(image.Rect(right - 2, top, right, bottom), outline)
+
+	ran := color.RGBA{0, 0, 255, 255} // blue
+	if bot.Team == TeamA {
+		ran = color.RGBA{255, 0, 0, 255} // red
+	}
+	panelTop := state.Arena.Height * writer.PixelsPerCell
+	nodesPerRow := state.Arena.Width * writer.PixelsPerCell / TRACE_PIXELS_PER_NODE
+	drawNode := func(n int, c color.RGBA) {
+		x, y := n % nodesPerRow * TRACE_PIXELS_PER_NODE, panelTop + n / nodesPerRow * TRACE_PIXELS_PER_NODE
+		writer.CurrentImage.DrawRect(image.Rect(x, y, x + TRACE_PIXELS_PER_NODE - 1, y + TRACE_PIXELS_PER_NODE - 1), c)
+	}
+	for n := 0; n < bot.Script.Code.Size(); n++ {
+		drawNode(n, color.RGBA{200, 200, 200, 255}) // grey
+	}
+	for _, n := range tracer.Numbers(trace) {
+		drawNode(n, ran)
+	}
+}
+
 func (writer *ImageWriter) FinishImage() {
 	path := writer.CurrentImage.Filename
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
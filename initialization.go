@@ -0,0 +1,97 @@
+package main
+
+import "math/rand"
+
+// Different ways of making brand new random scripts. The scenario decides which one gets used.
+type InitMethod int
+const (
+	WrapInit InitMethod = iota   // Wraps a random node in more functions until it's big enough, making long skinny chains.
+	GrowInit                     // Picks any function or terminal for each branch, down to a random depth.
+	FullInit                     // Only picks functions with arguments until it gets to a random depth.
+	RampedInit                   // Uses grow for half the scripts and full for the other half.
+	NumberOfInitMethods
+)
+
+var INIT_METHOD_NAMES = [NumberOfInitMethods]string{"wrap", "grow", "full", "ramped"}
+
+// The default range of depths for new scripts. Full scripts get big quickly, since `if` takes three arguments.
+const MIN_INITIAL_DEPTH = 2
+const MAX_INITIAL_DEPTH = 6
+
+func (method InitMethod) String() string {
+	return INIT_METHOD_NAMES[method]
+}
+
+func ParseInitMethod(name string) (InitMethod, error) {
+	method, err := lookUpName(INIT_METHOD_NAMES[:], name, "initialization method")
+	return InitMethod(method), err
+}
+
+func NewRandomScript() string {
+	return FormatScript(NewRandomTree())
+}
+
+// Makes a whole new script with the scenario's initialization method. The main body and the subroutines are all
+// made with the same method and depth.
+func NewRandomTree() *ScriptNode {
+	method := CurrentConfig.initialization
+	switch method {
+	case WrapInit:
+		return RandomTree(MIN_EXPRS_PER_SCRIPT)
+	case RampedInit:
+		method = GrowInit + InitMethod(rand.Intn(2))
+	}
+
+	depth := CurrentConfig.MinInitialDepth + rand.Intn(CurrentConfig.MaxInitialDepth - CurrentConfig.MinInitialDepth + 1)
+	program := &ScriptNode{Type: Program}
+	for i := 0; i <= NUM_SUBROUTINES; i++ {
+		program.Children = append(program.Children, forBody(i > 0, func() *ScriptNode {
+			return DepthLimitedExpr(depth, SCRIPT_TYPE, method == FullInit)
+		}))
+	}
+	randomlyPruneTree(program)
+	return program
+}
+
+// Generates a random expression of type t that's at most maxDepth deep. If full is true, every branch goes all the way
+// down to maxDepth, as far as the scenario's functions allow. UseScenarioConfig makes sure that the scenario can make
+// a script as shallow as minInitialDepth, and we only ever pick functions whose arguments we can make in the depth
+// that's left, so we never have to go deeper than maxDepth.
+func DepthLimitedExpr(maxDepth int, t ValueType, full bool) *ScriptNode {
+	numeric := t == TypeNumber || t == TypeDirection
+	fits := func(f Function) bool {
+		depth := CurrentConfig.callDepth(f, t)
+		return depth > 0 && depth <= maxDepth
+	}
+
+	if maxDepth > 1 {
+		if full {
+			hasArgs := func(f Function) bool { return f.Arity > 0 && fits(f) }
+			if function, ok := CurrentConfig.makersOf(t).pickWhere(hasArgs); ok {
+				return depthLimitedCall(function, maxDepth, t, full)
+			}
+		} else if !numeric || (rand.Float64() >= CurrentConfig.IntegerPercent && CurrentConfig.canMake(t)) {
+			if function, ok := CurrentConfig.makersOf(t).pickWhere(fits); ok {
+				return depthLimitedCall(function, maxDepth, t, full)
+			}
+		}
+	}
+
+	if terminal := randomTerminal(t); terminal != nil {
+		return terminal
+	}
+	// We only get here if maxDepth is shallower than anything we can make of this type, which UseScenarioConfig rules
+	// out. Going a bit too deep is better than making a broken script, though.
+	function, _ := CurrentConfig.makersOf(t).pickWhere(func(f Function) bool {
+		return CurrentConfig.callDepth(f, t) == CurrentConfig.minDepths[t]
+	})
+	return depthLimitedCall(function, CurrentConfig.minDepths[t], t, false)
+}
+
+func depthLimitedCall(function Function, maxDepth int, t ValueType, full bool) *ScriptNode {
+	node := &ScriptNode{Type: Expr, Children: []*ScriptNode{{Type: FuncName, Func: function}}}
+	for _, argType := range function.ArgTypes {
+		node.Children = append(node.Children, DepthLimitedExpr(maxDepth - 1, resolveType(argType, t), full))
+	}
+	return node
+}
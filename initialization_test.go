@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useInitialization(t *testing.T, method InitMethod, minDepth, maxDepth int) {
+	assert.NoError(t, withScenarioConfig(t, initialization(method.String(), minDepth, maxDepth)))
+}
+
+func initialization(method string, minDepth, maxDepth int) func(*ScenarioConfig) {
+	return func(config *ScenarioConfig) {
+		config.Initialization, config.MinInitialDepth, config.MaxInitialDepth = method, minDepth, maxDepth
+	}
+}
+
+func TestFullInitialization(t *testing.T) {
+	useInitialization(t, FullInit, 4, 4)
+
+	for i := 0; i < 100; i++ {
+		tree := NewRandomTree()
+		assert.NoError(t, TypeCheck(tree), oneLine(tree))
+		for _, body := range tree.Children {
+			assert.Equal(t, 4, body.Depth(), oneLine(body))
+		}
+	}
+}
+
+func TestGrowInitialization(t *testing.T) {
+	useInitialization(t, GrowInit, 2, 5)
+
+	depths := map[int]bool{}
+	for i := 0; i < 200; i++ {
+		tree := NewRandomTree()
+		assert.NoError(t, TypeCheck(tree), oneLine(tree))
+		assert.LessOrEqual(t, tree.Depth(), 5, oneLine(tree))
+		depths[tree.Depth()] = true
+	}
+	assert.True(t, depths[2] && depths[5], depths)
+}
+
+func TestRampedInitialization(t *testing.T) {
+	useInitialization(t, RampedInit, 3, 3)
+
+	// Full scripts always reach depth 3 in every body; grown ones usually don't.
+	full, grown := 0, 0
+	for i := 0; i < 200; i++ {
+		tree := NewRandomTree()
+		assert.NoError(t, TypeCheck(tree), oneLine(tree))
+		allFull := true
+		for _, body := range tree.Children {
+			allFull = allFull && body.Depth() == 3
+		}
+		if allFull {
+			full++
+		} else {
+			grown++
+		}
+	}
+	assert.Greater(t, full, 50)
+	assert.Greater(t, grown, 50)
+}
+
+func TestFullInitializationWithoutTerminals(t *testing.T) {
+	// Nothing here makes an action or a boolean without arguments, so every script is a `move`.
+	assert.NoError(t, withScenarioConfig(t, func(config *ScenarioConfig) {
+		config.FunctionWeights = map[string]float64{"move": 1, "<": 1}
+		config.Initialization, config.MinInitialDepth, config.MaxInitialDepth = "full", 2, 2
+	}))
+	for i := 0; i < 20; i++ {
+		tree := NewRandomTree()
+		assert.NoError(t, TypeCheck(tree), oneLine(tree))
+		assert.Equal(t, 2, tree.Depth(), oneLine(tree))
+	}
+}
+
+func TestInitializationWithoutShootNearest(t *testing.T) {
+	// `wait` is off by default too, so nothing makes an action without arguments.
+	withoutShootNearest := func(method InitMethod) func(*ScenarioConfig) {
+		return func(config *ScenarioConfig) {
+			delete(config.FunctionWeights, "shoot-nearest")
+			config.Initialization, config.MinInitialDepth, config.MaxInitialDepth = method.String(), 2, 4
+		}
+	}
+
+	for _, method := range []InitMethod{FullInit, GrowInit} {
+		assert.NoError(t, withScenarioConfig(t, withoutShootNearest(method)))
+		assert.Equal(t, 2, CurrentConfig.minDepths[TypeAction])
+		assert.Equal(t, 1, CurrentConfig.minDepths[TypeBoolean])
+		for i := 0; i < 200; i++ {
+			tree := NewRandomTree()
+			assert.NoError(t, TypeCheck(tree), oneLine(tree))
+			assert.LessOrEqual(t, tree.Depth(), 4, oneLine(tree))
+			if method == FullInit {
+				// Every body is as deep as the first one.
+				for _, body := range tree.Children {
+					assert.Equal(t, tree.Children[0].Depth(), body.Depth(), oneLine(tree))
+				}
+			}
+		}
+	}
+}
+
+func TestInitializationConfig(t *testing.T) {
+	assert.Error(t, withScenarioConfig(t, initialization("fnord", 2, 6)))
+	assert.Error(t, withScenarioConfig(t, initialization("grow", 0, 6)))
+	assert.Error(t, withScenarioConfig(t, initialization("grow", 1, 1)))
+	assert.Error(t, withScenarioConfig(t, initialization("grow", 5, 4)))
+	assert.Error(t, withScenarioConfig(t, initialization("grow", 2, MAX_DEPTH_PER_SCRIPT + 1)))
+	assert.NoError(t, withScenarioConfig(t, initialization("full", 3, 3)))
+	assert.Equal(t, FullInit, CurrentConfig.initialization)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A problem that the linter found in a script.
+type LintWarning struct {
+	Message string
+	Degenerate bool   // True if the problem makes the script useless, rather than just wasteful.
+}
+
+// What a piece of code might do when it runs: return a value, or stop the script with one of a set of actions.
+type outcomes struct {
+	actions map[string]bool   // The code of each action it might take
+	varies bool               // True if any of those actions has arguments that aren't constant
+	value bool                // True if it can return a value instead of taking an action
+}
+
+func valueOutcome() *outcomes {
+	return &outcomes{actions: map[string]bool{}, value: true}
+}
+
+// Adds the actions that `other` might take. If other can return a value, that's up to the caller.
+func (o *outcomes) addActions(other *outcomes) {
+	for action := range other.actions {
+		o.actions[action] = true
+	}
+	o.varies = o.varies || other.varies
+}
+
+type linter struct {
+	program *ScriptNode
+	warnings []LintWarning
+	context string                     // Where we are in the script, for the warning messages
+	subroutines map[int]*outcomes      // What we've already worked out for each subroutine
+}
+
+// Looks for code that can never run, and for scripts that can't possibly do anything interesting.
+func LintScript(tree *ScriptNode) []LintWarning {
+	tree = withoutSubroutines(tree)
+	l := &linter{program: tree, subroutines: make(map[int]*outcomes)}
+	main := l.analyze(tree.Children[0], NUM_SUBROUTINES)
+
+	// Subroutines that never get called can still have unreachable code in them.
+	for n := range tree.Children[1:] {
+		l.subroutine(n)
+	}
+
+	// If the script doesn't take an action, the bot waits.
+	if main.value {
+		main.actions["(wait)"] = true
+	}
+	if len(main.actions) == 1 && main.actions["(wait)"] {
+		l.degenerate("The script never does anything except wait")
+	} else if len(main.actions) == 1 && !main.varies {
+		for action := range main.actions {
+			l.degenerate(fmt.Sprintf("The script always does the same thing: %s", action))
+		}
+	}
+	return l.warnings
+}
+
+func IsDegenerate(warnings []LintWarning) bool {
+	for _, warning := range warnings {
+		if warning.Degenerate {
+			return true
+		}
+	}
+	return false
+}
+
+// Puts a plain expression into the same shape as a script with subroutines, so that we only have one case to handle.
+func withoutSubroutines(tree *ScriptNode) *ScriptNode {
+	if tree.Type == Program {
+		return tree
+	}
+	return &ScriptNode{Type: Program, Children: []*ScriptNode{tree}}
+}
+
+func (l *linter) warn(message string) {
+	l.warnings = append(l.warnings, LintWarning{Message: l.context + message})
+}
+
+func (l *linter) degenerate(message string) {
+	l.warnings = append(l.warnings, LintWarning{Message: message, Degenerate: true})
+}
+
+func (l *linter) subroutine(n int) *outcomes {
+	if result, found := l.subroutines[n]; found {
+		return result
+	}
+	// Subroutines can only call lower-numbered ones, so this can't recurse forever.
+	oldContext := l.context
+	l.context = fmt.Sprintf("In subroutine %d: ", n)
+	result := l.analyze(l.program.Children[n + 1], n)
+	l.context = oldContext
+
+	l.subroutines[n] = result
+	return result
+}
+
+// Works out what a node might do, given that it's running at the given subroutine level.
+func (l *linter) analyze(node *ScriptNode, level int) *outcomes {
+	if node.Type != Expr {
+		return valueOutcome()
+	}
+
+	function := node.Children[0].Func
+	args := node.Children[1:]
+	result := &outcomes{actions: map[string]bool{}}
+
+	switch function.Name {
+	case "if":
+		condition := l.analyze(args[0], level)
+		result.addActions(condition)
+		if !condition.value {
+			return result
+		}
+		branches := args[1:]
+		if isConstant, value := constantValue(args[0]); isConstant {
+			if value > 0 {
+				l.warn(fmt.Sprintf("The condition %s is always true, so %s never runs", oneLine(args[0]), oneLine(args[2])))
+				branches = args[1:2]
+			} else {
+				l.warn(fmt.Sprintf("The condition %s is always false, so %s never runs", oneLine(args[0]), oneLine(args[1])))
+				branches = args[2:3]
+			}
+		}
+		for _, branch := range branches {
+			outcome := l.analyze(branch, level)
+			result.addActions(outcome)
+			result.value = result.value || outcome.value
+		}
+		return result
+
+	case "and", "or":
+		first := l.analyze(args[0], level)
+		result.addActions(first)
+		if !first.value {
+			return result
+		}
+		result.value = true
+		if isConstant, value := constantValue(args[0]); isConstant {
+			// These have to match RS_And and RS_Or exactly.
+			if function.Name == "and" && value == 0 {
+				l.warn(fmt.Sprintf("%s is always false, so %s never runs", oneLine(args[0]), oneLine(args[1])))
+				return result
+			} else if function.Name == "or" && value > 0 {
+				l.warn(fmt.Sprintf("%s is always true, so %s never runs", oneLine(args[0]), oneLine(args[1])))
+				return result
+			}
+		}
+		result.addActions(l.analyze(args[1], level))
+		return result
+
+	case "not":
+		// 'not' swallows any actions that happen inside it.
+		l.analyze(args[0], level)
+		return valueOutcome()
+	}
+
+	// Everything else is strict, so any of the arguments might stop the script before the function gets to run.
+	argsHaveValues := true
+	for _, arg := range args {
+		outcome := l.analyze(arg, level)
+		result.addActions(outcome)
+		argsHaveValues = argsHaveValues && outcome.value
+	}
+	if !argsHaveValues {
+		return result
+	}
+
+	if strings.HasPrefix(function.Name, "call-") {
+		n := strToInt(strings.TrimPrefix(function.Name, "call-"))
+		if n >= level || n + 1 >= len(l.program.Children) {
+			l.warn(fmt.Sprintf("%s can't call subroutine %d from here, so it always returns 0", oneLine(node), n))
+			result.value = true
+		} else {
+			called := l.subroutine(n)
+			result.addActions(called)
+			result.value = called.value
+		}
+	} else if function.Returns == TypeAction {
+		constant := true
+		for _, arg := range args {
+			if isConstant, _ := constantValue(arg); !isConstant {
+				constant = false
+			}
+		}
+		result.actions[oneLine(node)] = true
+		result.varies = result.varies || !constant
+	} else {
+		result.value = true
+	}
+	return result
+}
+
+// Squashes an expression onto one line for use in a message.
+func oneLine(node *ScriptNode) string {
+	return strings.Join(strings.Fields(FormatScript(node)), " ")
+}
+
+// Prints the linter's warnings about the script in the given file. Returns false if the script is broken or useless.
+func LintFile(path string) bool {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		logger.Fatalf("Couldn't read %s: %v", path, err)
+	}
+	tree, err := ParseScript(string(source))
+	if err != nil {
+		fmt.Printf("%s: %v\n", path, err)
+		return false
+	}
+
+	messages := []string{}
+	if err := TypeCheck(tree); err != nil {
+		messages = append(messages, err.Error())
+	}
+	warnings := LintScript(tree)
+	for _, warning := range warnings {
+		messages = append(messages, warning.Message)
+	}
+
+	for _, message := range messages {
+		fmt.Printf("%s: %s\n", path, message)
+	}
+	if len(messages) == 0 {
+		fmt.Printf("%s: No problems found.\n", path)
+	}
+	return !IsDegenerate(warnings)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lintMessages(code string) ([]string, bool) {
+	warnings := LintScript(MustParseScript(code))
+	messages := []string{}
+	for _, warning := range warnings {
+		messages = append(messages, warning.Message)
+	}
+	return messages, IsDegenerate(warnings)
+}
+
+func TestLintDegenerateScripts(t *testing.T) {
+	degenerate := map[string]string{
+		"(+ 1 2)": "The script never does anything except wait",
+		"(wait)": "The script never does anything except wait",
+		"(if (enemy-visible?) (wait) 3)": "The script never does anything except wait",
+		"(not (move 1))": "The script never does anything except wait",
+		"(shoot-nearest)": "The script always does the same thing: (shoot-nearest)",
+		"(if (enemy-visible?) (move 2) (move 2))": "The script always does the same thing: (move 2)",
+		"(+ (shoot-nearest) (tick))": "The script always does the same thing: (shoot-nearest)",
+	}
+	for code, expected := range degenerate {
+		messages, isDegenerate := lintMessages(code)
+		assert.True(t, isDegenerate, code)
+		assert.Contains(t, messages, expected, code)
+	}
+
+	fine := []string{
+		"(move (enemy-direction))",
+		"(if (enemy-visible?) (shoot-nearest) (move 2))",
+		"(if (enemy-visible?) (shoot-nearest) 0)",
+		"(defun 0 (move (arg-0))) (call-0 (tick) 0)",
+	}
+	for _, code := range fine {
+		messages, isDegenerate := lintMessages(code)
+		assert.False(t, isDegenerate, code)
+		assert.Empty(t, messages, code)
+	}
+}
+
+func TestLintUnreachableCode(t *testing.T) {
+	messages, isDegenerate := lintMessages("(if (> 3 2) (shoot-nearest) (move 2))")
+	assert.True(t, isDegenerate)
+	assert.Contains(t, messages, "The condition (> 3 2) is always true, so (move 2) never runs")
+
+	messages, isDegenerate = lintMessages("(if (enemy-visible?) (and (- 2 2) (move 1)) (or 1 (move 3)))")
+	assert.True(t, isDegenerate)
+	assert.Equal(t, []string{
+		"(- 2 2) is always false, so (move 1) never runs",
+		"1 is always true, so (move 3) never runs",
+		"The script never does anything except wait",
+	}, messages)
+
+	messages, isDegenerate = lintMessages("(defun 0 (if (enemy-visible?) (call-1 1 2) (move 1))) (if (enemy-visible?) (call-0 1 2) (shoot-nearest))")
+	assert.False(t, isDegenerate)
+	assert.Equal(t, []string{"In subroutine 0: (call-1 1 2) can't call subroutine 1 from here, so it always returns 0"}, messages)
+
+	// Unused subroutines get checked too.
+	messages, _ = lintMessages("(defun 1 (if 0 (move 1) (move 2))) (move (tick))")
+	assert.Equal(t, []string{"In subroutine 1: The condition 0 is always false, so (move 1) never runs"}, messages)
+}
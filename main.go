@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
@@ -22,14 +23,45 @@ func main() {
 	logger = log.New(os.Stdout, "", log.Ldate | log.Ltime)
 	InitScript()
 
+	// Linting and explaining don't need an arena, and loading one takes a while.
+	if os.Args[1] == "lint" {
+		requireArgs(1, "lint <file>")
+		if !LintFile(os.Args[2]) {
+			os.Exit(1)
+		}
+		return
+	}
+	if os.Args[1] == "explain" {
+		requireArgs(3, "explain <scenario> <generation> <script>")
+		ExplainFile(os.Args[2], strToInt(os.Args[3]), strToInt(os.Args[4]))
+		return
+	}
+
 	arena := LoadArena("arena.png")
 	logger.Printf("Loaded %dx%d arena.", arena.Width, arena.Height)
 	if os.Getenv("PROF") != "" {
 		defer profile.Start(profile.ProfilePath(".")).Stop()
 	}
+	if budget := os.Getenv("EVAL_BUDGET"); budget != "" {
+		EvalBudget = strToInt(budget)
+	}
 
 	action := os.Args[1]
+	if action == "repl" {
+		setupFile := ""
+		if len(os.Args) > 2 {
+			setupFile = os.Args[2]
+		}
+		NewRepl(arena, os.Stdout).Run(setupFile, os.Stdin)
+		return
+	}
+
 	scenario := os.Args[2]
+	if action == "run" || action == "view" {
+		if err := UseScenarioConfig(LoadScenarioConfig(scenario)); err != nil {
+			logger.Fatalf("Bad config in %s: %v", ScenarioConfigPath(scenario), err)
+		}
+	}
 
 	switch action {
 	case "run":
@@ -49,13 +81,19 @@ func main() {
 
 		gen := NewGeneration(scenario, genId, arena)
 		vis := NewMp4Visualizer(gen.FileManager)
+		vis.Tracer = NewTracer()
 		gen.Initialize(vis)
 		scriptA, scriptB := gen.FileManager.FindScriptIds(matchId)
-		match := NewMatch(gen, matchId, scriptA, scriptB)
+		match, err := NewMatch(gen, matchId, scriptA, scriptB)
+		if err != nil {
+			logger.Fatalf("Can't load match %d: %v", matchId, err)
+		}
+		match.EnableTracing(vis.Tracer)
 		match.Run()
-		logger.Printf("Match %d: script %d: %d points, script %d: %d points", matchId, scriptA, match.Scores[TeamA], scriptB, match.Scores[TeamB])
+		gen.FileManager.WriteTraces(matchId, vis.Tracer)
+		logger.Printf("Match %d: script %d: %d points, script %d: %d points", matchId, scriptA, match.State.Scores[TeamA], scriptB, match.State.Scores[TeamB])
 		cmd := exec.Command("open", vis.OutputFile())
-		err := cmd.Run()
+		err = cmd.Run()
 		if err != nil {
 			logger.Fatalf("Failed to run 'open': %v", err)
 		}
@@ -69,3 +107,11 @@ func main() {
 
 	logger.Printf("Done!")
 }
+
+// Exits with a usage message if the command didn't get enough arguments.
+func requireArgs(count int, usage string) {
+	if len(os.Args) < count + 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n", os.Args[0], usage)
+		os.Exit(2)
+	}
+}
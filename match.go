@@ -25,12 +25,16 @@ type Action struct {
 	Target *Cell
 }
 
+// The number of integer registers each bot has for remembering things between ticks.
+const MEMORY_REGISTERS = 8
+
 type Bot struct {
 	Team Team
 	Id int
 	Position *Cell
 	Script Script
 	Alive bool
+	Memory [MEMORY_REGISTERS]int
 }
 
 type Goal struct {
@@ -46,25 +50,34 @@ type Match struct {
 	Id int
 	ScriptA int
 	ScriptB int
-	Scores [2]int
 	Moved [2]bool
+	OverBudgetTicks [2]int   // The number of ticks on which at least one of the team's bots ran out of evaluation budget
+	overBudget [2]bool
 }
 
 var currentMatch *Match
 var turnSequence = []int{0, 5, 1, 6, 2, 7, 3, 8, 4, 9}  // Alternates bots from different teams
 
-func NewMatch(generation *Generation, id int, scriptId_A int, scriptId_B int) *Match {
+func NewMatch(generation *Generation, id int, scriptId_A int, scriptId_B int) (*Match, error) {
 	rng := rand.New(rand.NewSource(int64(id)))
 	state := NewGameState(generation.Arena)
-	match := &Match{rng, state, generation, id,  scriptId_A, scriptId_B, [2]int{0, 0}, [2]bool{false, false}}
-
-	scripts := [2]Script{generation.FileManager.LoadScript(state, scriptId_A), generation.FileManager.LoadScript(state, scriptId_B)}
+	state.Rand = rng
+	match := &Match{rng, state, generation, id,  scriptId_A, scriptId_B, [2]bool{false, false}, [2]int{0, 0}, [2]bool{false, false}}
+
+	var scripts [2]Script
+	for team, scriptId := range [2]int{scriptId_A, scriptId_B} {
+		script, err := generation.FileManager.LoadScript(state, scriptId)
+		if err != nil {
+			return nil, err
+		}
+		scripts[team] = script
+	}
 	for i, bot := range state.Bots {
 		state.Bots[i].Script = scripts[bot.Team]
 	}
 
 	generation.Visualizer.Init(state)
-	return match
+	return match, nil
 }
 
 func (m *Match) Run() {
@@ -84,19 +97,25 @@ func (m *Match) RunTick() bool {
 			m.Generation.Visualizer.NoChange()
 		}
 	}
+	for team := range m.overBudget {
+		if m.overBudget[team] {
+			m.OverBudgetTicks[team]++
+			m.overBudget[team] = false
+		}
+	}
 
 	m.Generation.Visualizer.TickComplete()
 	m.State.Tick++
 	if m.State.Tick >= MAX_TICKS_PER_GAME {  // Penalize both teams if the game runs too long.
-		m.Scores[TeamA] -= 5
-		m.Scores[TeamB] -= 5
+		m.State.Scores[TeamA] -= 5
+		m.State.Scores[TeamB] -= 5
 	}
 
 	if m.State.IsGameOver() {
 		// If no bot on a team has moved during the match, penalize them 5 points.
 		for i := 0; i < len(m.Moved); i++ {
 			if !m.Moved[i] {
-				m.Scores[i] -= 5
+				m.State.Scores[i] -= 5
 			}
 		}
 		m.Generation.Visualizer.Finish()
@@ -107,7 +126,14 @@ func (m *Match) RunTick() bool {
 
 func (m *Match) RunOneBot(bot *Bot) {
 	m.State.CurrentBot = bot
+	m.State.Broadcasts = m.State.Broadcasts[:0]
 	action := bot.Script.Run().Action
+	if bot.Script.OverBudget {
+		m.overBudget[bot.Team] = true
+	}
+	for _, broadcast := range m.State.Broadcasts {
+		m.Generation.Visualizer.Broadcast(broadcast)
+	}
 	switch action.Type {
 	case ActionWait:
 		bot.Position.Waits++
@@ -146,19 +172,19 @@ func (m *Match) BotShoot(bot *Bot, action Action) {
 			targetBot.Position.Kills++
 			if targetBot.Team == bot.Team {
 				// logger.Printf("Friendly fire on team %d! Bot %d killed bot %d. (%d, %d)", bot.Team, bot.Id, targetBot.Id, targetBot.Position.X, targetBot.Position.Y)
-				m.Scores[bot.Team] -= 2  // penalty for friendly fire
+				m.State.Scores[bot.Team] -= 2  // penalty for friendly fire
 			} else {
 				// logger.Printf("Bot %d from team %d killed enemy bot %d", bot.Id, bot.Team, targetBot.Id)
-				m.Scores[bot.Team] += 1
+				m.State.Scores[bot.Team] += 1
 			}
 		} else if targetGoal != nil {
 			targetGoal.Alive = false
 			if targetGoal.Team == bot.Team {
 				// logger.Printf("Own goal for team %d!", bot.Team)
-				m.Scores[bot.Team] -= 20  // massive penalty for an own-goal
+				m.State.Scores[bot.Team] -= 20  // massive penalty for an own-goal
 			} else {
 				// logger.Printf("Team %d destroyed the other team's goal", bot.Team)
-				m.Scores[bot.Team] += 10
+				m.State.Scores[bot.Team] += 10
 			}
 		}
 		// Otherwise you probably shot a wall, so we do nothing.
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Replacing a whole branch of a script with new random code throws away a lot of what made the parent good, so we
+// also have gentler ways of changing a script. The scenario decides how often each of them gets used.
+type MutationOperator int
+const (
+	SubtreeMutation MutationOperator = iota   // Replaces a random branch with a brand new one.
+	PointMutation                             // Changes one function to a similar one, or one number to a nearby one.
+	ArgumentSwap                              // Swaps two arguments of the same type.
+	SubtreeDuplication                        // Copies a branch over some other branch of the same type.
+	HoistMutation                             // Replaces the main body or a subroutine with one of its own branches.
+	ShrinkMutation                            // Replaces a branch with one of its arguments, or with something tiny.
+	NumberOfMutationOperators
+)
+
+var MUTATION_OPERATOR_NAMES = [NumberOfMutationOperators]string{"subtree", "point", "swap", "duplicate", "hoist", "shrink"}
+
+// Scripts tend to get bigger and bigger over the generations, so the operators that make them smaller get used more
+// as they grow. Their weights are scaled by the script's size over MAX_EXPRS_PER_SCRIPT; a script that's at the limit
+// uses them at their full weight, and a tiny one hardly ever does. See pickMutation.
+var BLOAT_CONTROL_OPERATORS = map[MutationOperator]bool{HoistMutation: true, ShrinkMutation: true}
+
+// The furthest that point mutation will move a number.
+const MAX_NUDGE = 3
+
+func (op MutationOperator) String() string {
+	return MUTATION_OPERATOR_NAMES[op]
+}
+
+func ParseMutationOperator(name string) (MutationOperator, error) {
+	op, err := lookUpName(MUTATION_OPERATOR_NAMES[:], name, "mutation operator")
+	return MutationOperator(op), err
+}
+
+// Changes the script with one of the mutation operators. Returns the new script and the operator that made it.
+func MutateScript(script string) (string, MutationOperator, error) {
+	tree, err := ParseScript(script)
+	if err != nil {
+		return "", 0, err
+	}
+	tree = withSubroutines(tree)
+	operator := CurrentConfig.pickMutation(tree.Size())
+	if !mutateTree(tree, operator) {
+		// Some scripts have nowhere that the other operators can work, but we can always replace a subtree.
+		operator = SubtreeMutation
+		mutateTree(tree, operator)
+	}
+	randomlyPruneTree(tree)
+	return FormatScript(tree), operator, nil
+}
+
+// Changes the tree in place. Returns false if the operator can't find anywhere in the tree to work.
+func mutateTree(tree *ScriptNode, operator MutationOperator) bool {
+	switch operator {
+	case PointMutation:
+		return pointMutation(tree)
+	case ArgumentSwap:
+		return swapArguments(tree)
+	case SubtreeDuplication:
+		return duplicateSubtree(tree)
+	case HoistMutation:
+		return hoistSubtree(tree)
+	case ShrinkMutation:
+		return shrinkSubtree(tree)
+	}
+	location := chooseRandomLocation(tree)
+	location.Parent.Children[location.Index] = forBody(inSubroutine(tree, location), func() *ScriptNode {
+		return RandomExpr(MUTATION_SIZE, location.Type)
+	})
+	return true
+}
+
+func pointMutation(tree *ScriptNode) bool {
+	locations := linearizeChildren(tree)
+	rand.Shuffle(len(locations), func(i, j int) {
+		locations[i], locations[j] = locations[j], locations[i]
+	})
+
+	for _, location := range locations {
+		node := location.Node
+		switch node.Type {
+		case Int:
+			// The parser fills in missing subroutines with a 0, and that has to stay a 0.
+			if typeFits(location.Type, TypeNumber) {
+				node.N += nudge()
+				return true
+			}
+		case Expr:
+			similar := similarFunctions(node.Children[0].Func, location.Type, inSubroutine(tree, location))
+			if len(similar) > 0 {
+				node.Children[0] = &ScriptNode{Type: FuncName, Func: similar[rand.Intn(len(similar))]}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A small random change to a number, up or down.
+func nudge() int {
+	n := 1 + rand.Intn(MAX_NUDGE)
+	if rand.Intn(2) == 0 {
+		return -n
+	}
+	return n
+}
+
+// Returns the functions that the generator could use in place of the given one, in a place that expects type t,
+// without changing any of its arguments.
+func similarFunctions(function Function, t ValueType, subroutine bool) []Function {
+	similar := []Function{}
+	for _, candidate := range CurrentConfig.bodyMakers(t, subroutine).functions {
+		if candidate.Name == function.Name || candidate.Arity != function.Arity {
+			continue
+		}
+		fits := true
+		for i := range candidate.ArgTypes {
+			fits = fits && resolveType(candidate.ArgTypes[i], t) == resolveType(function.ArgTypes[i], t)
+		}
+		if fits {
+			similar = append(similar, candidate)
+		}
+	}
+	return similar
+}
+
+func swapArguments(tree *ScriptNode) bool {
+	type argumentPair struct {
+		node *ScriptNode
+		i, j int
+	}
+	pairs := []argumentPair{}
+	for _, location := range linearizeChildren(tree) {
+		if location.Node.Type != Expr {
+			continue
+		}
+		args, argTypes := location.Node.Children[1:], location.Node.Children[0].Func.ArgTypes
+		for i := range args {
+			for j := i + 1; j < len(args); j++ {
+				sameType := resolveType(argTypes[i], location.Type) == resolveType(argTypes[j], location.Type)
+				if sameType && !sameCode(args[i], args[j]) {
+					pairs = append(pairs, argumentPair{location.Node, i + 1, j + 1})
+				}
+			}
+		}
+	}
+	if len(pairs) == 0 {
+		return false
+	}
+
+	pair := pairs[rand.Intn(len(pairs))]
+	pair.node.Children[pair.i], pair.node.Children[pair.j] = pair.node.Children[pair.j], pair.node.Children[pair.i]
+	return true
+}
+
+func duplicateSubtree(tree *ScriptNode) bool {
+	locations := linearizeChildren(tree)
+	sources := copyableBranches(tree)
+	if len(sources) == 0 {
+		return false
+	}
+	source := sources[rand.Intn(len(sources))]
+
+	// Copying a branch over itself or over a branch that contains it would just lose code instead of duplicating it.
+	targets := []TreeLocation{}
+	for _, location := range locations {
+		if location.Node.Type != FuncName && typeFits(location.Type, source.Type) && !containsNode(location.Node, source.Node) &&
+		   !sameCode(location.Node, source.Node) {
+			targets = append(targets, location)
+		}
+	}
+	if len(targets) == 0 {
+		return false
+	}
+
+	target := targets[rand.Intn(len(targets))]
+	target.Parent.Children[target.Index] = copyTree(source.Node)
+	return true
+}
+
+// Only works on whole scripts, since a bare expression has nowhere to hoist anything to.
+func hoistSubtree(tree *ScriptNode) bool {
+	if tree.Type != Program {
+		return false
+	}
+
+	type hoist struct {
+		body int
+		node *ScriptNode
+	}
+	candidates := []hoist{}
+	for i, body := range tree.Children {
+		if body.Type != Expr {
+			continue
+		}
+		for _, location := range linearizeTypedChildren(body, SCRIPT_TYPE) {
+			if location.Node.Type != FuncName && typeFits(SCRIPT_TYPE, location.Type) {
+				candidates = append(candidates, hoist{i, location.Node})
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return false
+	}
+
+	choice := candidates[rand.Intn(len(candidates))]
+	tree.Children[choice.body] = choice.node
+	return true
+}
+
+func shrinkSubtree(tree *ScriptNode) bool {
+	locations := linearizeChildren(tree)
+	rand.Shuffle(len(locations), func(i, j int) {
+		locations[i], locations[j] = locations[j], locations[i]
+	})
+
+	for _, location := range locations {
+		node := location.Node
+		if node.Type != Expr || len(node.Children) == 1 {
+			continue
+		}
+		candidates := []*ScriptNode{}
+		for i, arg := range node.Children[1:] {
+			if typeFits(location.Type, resolveType(node.Children[0].Func.ArgTypes[i], location.Type)) {
+				candidates = append(candidates, arg)
+			}
+		}
+		terminal := forBody(inSubroutine(tree, location), func() *ScriptNode { return randomTerminal(location.Type) })
+		if terminal != nil {
+			candidates = append(candidates, terminal)
+		}
+		if len(candidates) > 0 {
+			location.Parent.Children[location.Index] = candidates[rand.Intn(len(candidates))]
+			return true
+		}
+	}
+	return false
+}
+
+func containsNode(tree, node *ScriptNode) bool {
+	if tree == node {
+		return true
+	}
+	for _, child := range tree.Children {
+		if containsNode(child, node) {
+			return true
+		}
+	}
+	return false
+}
+
+// Picks a mutation operator for a script with the given number of expressions at random, in proportion to the
+// scenario's weights.
+func (c *ScenarioConfig) pickMutation(size int) MutationOperator {
+	var totals [NumberOfMutationOperators]float64
+	total := 0.0
+	for op, weight := range c.mutationWeights {
+		if BLOAT_CONTROL_OPERATORS[MutationOperator(op)] {
+			weight *= float64(intMin(size, MAX_EXPRS_PER_SCRIPT)) / MAX_EXPRS_PER_SCRIPT
+		}
+		total += weight
+		totals[op] = total
+	}
+	if total == 0 {
+		return SubtreeMutation   // The scenario only uses the bloat control operators, and the script is tiny.
+	}
+
+	n := rand.Float64() * total
+	return MutationOperator(sort.Search(int(NumberOfMutationOperators), func(i int) bool {
+		return totals[i] > n
+	}))
+}
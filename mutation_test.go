@@ -0,0 +1,172 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Uses the default scenario config with some changes for the rest of the test, then goes back to the default. Returns
+// UseScenarioConfig's error, so tests can check that bad settings get turned down.
+func withScenarioConfig(t *testing.T, change func(*ScenarioConfig)) error {
+	t.Cleanup(func() { UseScenarioConfig(DefaultScenarioConfig()) })
+	config := DefaultScenarioConfig()
+	change(config)
+	return UseScenarioConfig(config)
+}
+
+func TestPointMutation(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code := "(if (< (tick) 3) (move (enemy-direction)) (shoot 2))"
+		tree := MustParseScript(code)
+		assert.True(t, mutateTree(tree, PointMutation))
+		assert.NoError(t, TypeCheck(tree), oneLine(tree))
+		assert.NotEqual(t, code, oneLine(tree))
+
+		// Exactly one thing changed, and nothing moved.
+		differences := 0
+		before, after := linearizeChildren(MustParseScript(code)), linearizeChildren(tree)
+		assert.Equal(t, len(before), len(after))
+		for j := range before {
+			if before[j].Node.Type != Expr && oneLine(before[j].Node) != oneLine(after[j].Node) {
+				differences++
+			}
+		}
+		assert.Equal(t, 1, differences, oneLine(tree))
+	}
+}
+
+func TestNudgeStaysNearby(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		n := nudge()
+		assert.True(t, n != 0 && intAbs(n) <= MAX_NUDGE, n)
+	}
+}
+
+func TestSimilarFunctions(t *testing.T) {
+	for _, function := range similarFunctions(FunctionLookupTable["enemy-visible?"], TypeBoolean, false) {
+		assert.Equal(t, 0, function.Arity, function.Name)
+		assert.Equal(t, TypeBoolean, function.Returns, function.Name)
+	}
+	assert.NotEmpty(t, similarFunctions(FunctionLookupTable["+"], TypeNumber, false))
+	assert.Empty(t, similarFunctions(FunctionLookupTable["shoot-nearest"], TypeAction, false))
+
+	// Only subroutines have arguments to use.
+	names := func(subroutine bool) []string {
+		var names []string
+		for _, function := range similarFunctions(FunctionLookupTable["tick"], TypeNumber, subroutine) {
+			names = append(names, function.Name)
+		}
+		return names
+	}
+	assert.NotContains(t, names(false), "arg-0")
+	assert.Contains(t, names(true), "arg-0")
+}
+
+// Gives the code a pair of subroutines that the mutation operators can't do anything with.
+const BORING_SUBROUTINES = "(defun 0 (shoot-nearest)) (defun 1 (shoot-nearest)) "
+
+func TestArgumentSwap(t *testing.T) {
+	tree := MustParseScript(BORING_SUBROUTINES + "(if (enemy-visible?) (move 1) (shoot 2))")
+	assert.True(t, mutateTree(tree, ArgumentSwap))
+	assert.Equal(t, BORING_SUBROUTINES + "(if (enemy-visible?) (shoot 2) (move 1))", oneLine(tree))
+
+	// Nothing here has two different arguments of the same type.
+	tree = MustParseScript(BORING_SUBROUTINES + "(if (can-move? 1) (move (+ 2 2)) (move (+ 2 2)))")
+	assert.False(t, mutateTree(tree, ArgumentSwap))
+}
+
+func TestSubtreeDuplication(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code := "(if (< (tick) 3) (move (enemy-direction)) (shoot 2))"
+		tree := MustParseScript(code)
+		if !mutateTree(tree, SubtreeDuplication) {
+			continue
+		}
+		assert.NoError(t, TypeCheck(tree), oneLine(tree))
+		assert.NotEqual(t, code, oneLine(tree))
+	}
+
+	// A script that's a single function call has nowhere to copy anything to.
+	assert.False(t, mutateTree(MustParseScript("(shoot-nearest)"), SubtreeDuplication))
+}
+
+func TestMutationWeights(t *testing.T) {
+	weights := func(weights map[string]float64) func(*ScenarioConfig) {
+		return func(config *ScenarioConfig) { config.MutationWeights = weights }
+	}
+
+	assert.Error(t, withScenarioConfig(t, weights(map[string]float64{"fnord": 1})))
+	assert.Error(t, withScenarioConfig(t, weights(map[string]float64{"point": -1, "swap": 2})))
+	assert.Error(t, withScenarioConfig(t, weights(map[string]float64{"point": 0})))
+
+	assert.NoError(t, withScenarioConfig(t, weights(map[string]float64{"subtree": 0, "point": 1, "swap": 0})))
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, PointMutation, CurrentConfig.pickMutation(10))
+	}
+}
+
+func TestHoistMutation(t *testing.T) {
+	code := BORING_SUBROUTINES + "(if (enemy-visible?) (move 1) (if (< (tick) 3) (shoot 2) (wait)))"
+	for i := 0; i < 100; i++ {
+		tree := MustParseScript(code)
+		assert.True(t, mutateTree(tree, HoistMutation))
+		assert.NoError(t, TypeCheck(tree), oneLine(tree))
+		assert.Less(t, tree.Size(), MustParseScript(code).Size(), oneLine(tree))
+	}
+
+	// There's nothing inside a lone function call to hoist.
+	assert.False(t, mutateTree(MustParseScript(BORING_SUBROUTINES + "(shoot-nearest)"), HoistMutation))
+}
+
+func TestShrinkMutation(t *testing.T) {
+	code := "(if (< (tick) 3) (move (enemy-direction)) (shoot (+ 2 (my-x-pos))))"
+	for i := 0; i < 100; i++ {
+		tree := MustParseScript(code)
+		assert.True(t, mutateTree(tree, ShrinkMutation))
+		assert.NoError(t, TypeCheck(tree), oneLine(tree))
+		assert.Less(t, tree.Size(), MustParseScript(code).Size(), oneLine(tree))
+	}
+
+	assert.False(t, mutateTree(MustParseScript("(shoot-nearest)"), ShrinkMutation))
+}
+
+func TestBloatControlDependsOnSize(t *testing.T) {
+	assert.NoError(t, withScenarioConfig(t, func(config *ScenarioConfig) {
+		config.MutationWeights = map[string]float64{"point": 1, "shrink": 1}
+	}))
+
+	shrinks := func(size int) int {
+		count := 0
+		for i := 0; i < 1000; i++ {
+			if CurrentConfig.pickMutation(size) == ShrinkMutation {
+				count++
+			}
+		}
+		return count
+	}
+	assert.Equal(t, 0, shrinks(0))
+	assert.Less(t, shrinks(MAX_EXPRS_PER_SCRIPT / 10), shrinks(MAX_EXPRS_PER_SCRIPT))
+	assert.InDelta(t, 500, shrinks(MAX_EXPRS_PER_SCRIPT * 2), 100)
+
+	// A scenario that only shrinks still has to do something to tiny scripts.
+	assert.NoError(t, withScenarioConfig(t, func(config *ScenarioConfig) {
+		config.MutationWeights = map[string]float64{"shrink": 1}
+	}))
+	assert.Equal(t, SubtreeMutation, CurrentConfig.pickMutation(0))
+}
+
+func TestMutateScriptReportsOperator(t *testing.T) {
+	assert.NoError(t, withScenarioConfig(t, func(config *ScenarioConfig) {
+		config.MutationWeights = map[string]float64{"swap": 1}
+	}))
+
+	_, operator, err := MutateScript(BORING_SUBROUTINES + "(if (enemy-visible?) (move 1) (shoot 2))")
+	assert.NoError(t, err)
+	assert.Equal(t, ArgumentSwap, operator)
+
+	// There's nothing to swap here, so it falls back to replacing a subtree.
+	_, operator, err = MutateScript(BORING_SUBROUTINES + "(shoot-nearest)")
+	assert.NoError(t, err)
+	assert.Equal(t, SubtreeMutation, operator)
+}
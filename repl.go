@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// An interactive prompt for trying out RoboScript against a game in progress. Anything that starts with a colon is a
+// command; everything else is evaluated as code for the current bot.
+type Repl struct {
+	State *GameState
+	match *Match
+	out io.Writer
+	pending string   // The start of an expression that continues on the next line
+}
+
+const REPL_HELP = `Type a RoboScript expression to see what it returns for the current bot, or one of these commands:
+  :bot N             Make bot N the current bot (0-4 are team A, 5-9 are team B)
+  :place N X Y       Put bot N at (X, Y)
+  :kill N            Kill bot N
+  :revive N          Bring bot N back to life
+  :script A|B FILE   Give a team's bots a script to run when the game advances
+  :tick [N]          Run the game for N ticks (default 1)
+  :state             Show the state of the game
+  :map               Draw the arena
+  :help              Show this message
+  :quit              Leave
+`
+
+func NewRepl(arena *Arena, out io.Writer) *Repl {
+	state := NewGameState(arena)
+	state.CurrentBot = &state.Bots[0]
+	generation := &Generation{Arena: arena, Visualizer: NewNullVisualizer()}
+	match := &Match{Rand: state.Rand, State: state, Generation: generation}
+
+	// Until they get real scripts, the bots just stand around.
+	waiting := MustParseScript("(wait)")
+	for i := range state.Bots {
+		state.Bots[i].Script = NewScript(waiting, state)
+	}
+	return &Repl{State: state, match: match, out: out}
+}
+
+// Runs the commands in the setup file (if any), then reads more until we run out or get told to quit.
+func (r *Repl) Run(setupFile string, in io.Reader) {
+	if setupFile != "" {
+		source, err := os.ReadFile(setupFile)
+		if err != nil {
+			logger.Fatalf("Couldn't read %s: %v", setupFile, err)
+		}
+		for _, line := range strings.Split(string(source), "\n") {
+			r.Execute(line)
+		}
+	}
+
+	fmt.Fprint(r.out, REPL_HELP)
+	scanner := bufio.NewScanner(in)
+	for {
+		if r.pending == "" {
+			fmt.Fprintf(r.out, "bot %d> ", r.State.CurrentBot.Id)
+		} else {
+			fmt.Fprint(r.out, "...> ")
+		}
+		if !scanner.Scan() || !r.Execute(scanner.Text()) {
+			break
+		}
+	}
+	fmt.Fprintln(r.out)
+}
+
+// Runs one line of input. Returns false if it's time to quit.
+func (r *Repl) Execute(line string) bool {
+	if r.pending == "" && strings.HasPrefix(strings.TrimSpace(line), ":") {
+		return r.command(strings.Fields(strings.TrimSpace(line)))
+	}
+
+	code := r.pending + line + "\n"
+	if strings.TrimSpace(code) == "" {
+		return true
+	}
+	tree, err := ParseScript(code)
+	var parseError *ParseError
+	if errors.As(err, &parseError) && strings.HasPrefix(parseError.Message, "Unterminated") {
+		r.pending = code   // Wait for the rest of it.
+		return true
+	}
+	r.pending = ""
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return true
+	}
+
+	r.State.Broadcasts = r.State.Broadcasts[:0]
+	script := Script{Code: tree, State: r.State, Budget: EvalBudget}
+	fmt.Fprintf(r.out, "=> %s\n", r.describe(script.Eval(tree)))
+	return true
+}
+
+func (r *Repl) describe(result Result) string {
+	switch result.Type {
+	case ResultInt:
+		return fmt.Sprintf("%d", result.Int)
+	case ResultError:
+		return fmt.Sprintf("error: %v", result.Err)
+	}
+
+	switch result.Action.Type {
+	case ActionMove:
+		return fmt.Sprintf("move to (%d, %d)", result.Action.Target.X, result.Action.Target.Y)
+	case ActionShoot:
+		return fmt.Sprintf("shoot at (%d, %d)", result.Action.Target.X, result.Action.Target.Y)
+	}
+	return "wait"
+}
+
+// How many arguments each command takes. :tick's is optional.
+var replCommandArgs = map[string]int{":bot": 1, ":place": 3, ":kill": 1, ":revive": 1, ":script": 2, ":tick": 1,
+                                     ":state": 0, ":map": 0, ":help": 0, ":quit": 0}
+
+func (r *Repl) command(words []string) bool {
+	expected, known := replCommandArgs[words[0]]
+	if !known {
+		fmt.Fprintf(r.out, "Error: unknown command '%s'. Try :help.\n", words[0])
+		return true
+	}
+	if len(words) - 1 != expected && !(words[0] == ":tick" && len(words) == 1) {
+		fmt.Fprintf(r.out, "Error: %s takes %d arguments\n", words[0], expected)
+		return true
+	}
+
+	// Every command's arguments are numbers, apart from :script's.
+	numbers := make([]int, 0, len(words))
+	if words[0] != ":script" {
+		for _, word := range words[1:] {
+			n, err := strconv.Atoi(word)
+			if err != nil {
+				fmt.Fprintf(r.out, "Error: '%s' isn't a number\n", word)
+				return true
+			}
+			numbers = append(numbers, n)
+		}
+	}
+
+	switch words[0] {
+	case ":bot":
+		if bot := r.bot(numbers[0]); bot != nil {
+			r.State.CurrentBot = bot
+		}
+	case ":place":
+		r.place(numbers[0], numbers[1], numbers[2])
+	case ":kill", ":revive":
+		if bot := r.bot(numbers[0]); bot != nil {
+			bot.Alive = words[0] == ":revive"
+		}
+	case ":script":
+		r.loadScript(words[1], words[2])
+	case ":tick":
+		ticks := 1
+		if len(numbers) > 0 {
+			ticks = numbers[0]
+		}
+		r.tick(ticks)
+	case ":state":
+		r.printState()
+	case ":map":
+		r.printMap()
+	case ":help":
+		fmt.Fprint(r.out, REPL_HELP)
+	case ":quit":
+		return false
+	}
+	return true
+}
+
+func (r *Repl) bot(id int) *Bot {
+	if id < 0 || id >= len(r.State.Bots) {
+		fmt.Fprintf(r.out, "Error: there's no bot %d\n", id)
+		return nil
+	}
+	return &r.State.Bots[id]
+}
+
+func (r *Repl) place(id, x, y int) {
+	bot := r.bot(id)
+	if bot == nil {
+		return
+	}
+	arena := r.State.Arena
+	if x < 0 || x >= arena.Width || y < 0 || y >= arena.Height {
+		fmt.Fprintf(r.out, "Error: (%d, %d) is outside the arena\n", x, y)
+		return
+	}
+	cell := &arena.Cells[x * arena.Height + y]
+	if r.State.BotAtCell(cell) != bot && !r.State.CellIsEmpty(cell) {
+		fmt.Fprintf(r.out, "Error: (%d, %d) isn't empty\n", x, y)
+		return
+	}
+	bot.Position = cell
+}
+
+func (r *Repl) loadScript(team string, path string) {
+	var t Team
+	switch strings.ToUpper(team) {
+	case "A": t = TeamA
+	case "B": t = TeamB
+	default:
+		fmt.Fprintf(r.out, "Error: there's no team '%s'\n", team)
+		return
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return
+	}
+	tree, err := ParseScript(string(source))
+	if err != nil {
+		fmt.Fprintf(r.out, "Error in %s: %v\n", path, err)
+		return
+	}
+	for i := range r.State.Bots {
+		if r.State.Bots[i].Team == t {
+			r.State.Bots[i].Script = NewScript(tree, r.State)
+		}
+	}
+}
+
+func (r *Repl) tick(ticks int) {
+	currentBot := r.State.CurrentBot
+	for i := 0; i < ticks; i++ {
+		if r.State.IsGameOver() {
+			fmt.Fprintln(r.out, "The game is over.")
+			break
+		}
+		r.match.RunTick()
+	}
+	r.State.CurrentBot = currentBot
+	fmt.Fprintf(r.out, "Tick %d. Scores: A %d, B %d\n", r.State.Tick, r.State.Scores[TeamA], r.State.Scores[TeamB])
+}
+
+func (r *Repl) printState() {
+	state := r.State
+	fmt.Fprintf(r.out, "Tick %d of %d. Scores: A %d, B %d\n", state.Tick, MAX_TICKS_PER_GAME, state.Scores[TeamA], state.Scores[TeamB])
+	for _, bot := range state.Bots {
+		status := "alive"
+		if !bot.Alive {
+			status = "dead"
+		}
+		marker := " "
+		if &state.Bots[bot.Id] == state.CurrentBot {
+			marker = "*"
+		}
+		fmt.Fprintf(r.out, "%s bot %d (team %s): (%d, %d), %s, memory %v\n", marker, bot.Id, teamName(bot.Team),
+		            bot.Position.X, bot.Position.Y, status, bot.Memory)
+	}
+	for _, goal := range state.Goals {
+		status := "intact"
+		if !goal.Alive {
+			status = "destroyed"
+		}
+		fmt.Fprintf(r.out, "  goal %s: (%d, %d), %s\n", teamName(goal.Team), goal.Position.X, goal.Position.Y, status)
+	}
+	for team, blackboard := range state.Blackboards {
+		fmt.Fprintf(r.out, "  blackboard %s: %v\n", teamName(Team(team)), blackboard)
+	}
+}
+
+// Walls are #, goals are A and B (lower case if destroyed), and bots are their IDs.
+func (r *Repl) printMap() {
+	arena := r.State.Arena
+	var sb strings.Builder
+	for y := 0; y < arena.Height; y++ {
+		for x := 0; x < arena.Width; x++ {
+			cell := &arena.Cells[x * arena.Height + y]
+			if bot := r.State.BotAtCell(cell); bot != nil {
+				sb.WriteString(fmt.Sprintf("%d", bot.Id))
+			} else if goal := r.State.GoalAtCell(cell); goal != nil {
+				name := teamName(goal.Team)
+				if !goal.Alive {
+					name = strings.ToLower(name)
+				}
+				sb.WriteString(name)
+			} else if cell.Type == WallCell {
+				sb.WriteString("#")
+			} else {
+				sb.WriteString(".")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprint(r.out, sb.String())
+}
+
+func teamName(team Team) string {
+	if team == TeamA {
+		return "A"
+	}
+	return "B"
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func replOutput(repl *Repl, lines ...string) string {
+	out := repl.out.(*bytes.Buffer)
+	out.Reset()
+	for _, line := range lines {
+		repl.Execute(line)
+	}
+	return out.String()
+}
+
+func TestReplExpressions(t *testing.T) {
+	repl := NewRepl(smallTestArena(), &bytes.Buffer{})
+
+	assert.Equal(t, "=> 7\n", replOutput(repl, "(+ 3 4)"))
+	assert.Equal(t, "=> 1\n", replOutput(repl, "(my-x-pos)"))
+	assert.Equal(t, "=> move to (2, 1)\n", replOutput(repl, "(move 0)"))
+	assert.Equal(t, "=> wait\n", replOutput(repl, "(wait)"))
+	assert.Contains(t, replOutput(repl, "(fnord)"), "Error: ")
+
+	// Unfinished expressions carry on to the next line.
+	assert.Equal(t, "=> 6\n", replOutput(repl, "(+ 1", "   (* 1 5))"))
+}
+
+func TestReplCommands(t *testing.T) {
+	repl := NewRepl(smallTestArena(), &bytes.Buffer{})
+
+	replOutput(repl, ":bot 7", ":place 7 8 3")
+	assert.Equal(t, 7, repl.State.CurrentBot.Id)
+	assert.Equal(t, &repl.State.Arena.Cells[8 * 7 + 3], repl.State.CurrentBot.Position)
+	assert.Equal(t, "=> 4\n", replOutput(repl, "(my-y-pos)"))
+
+	assert.Contains(t, replOutput(repl, ":place 7 5 3"), "isn't empty")
+	assert.Contains(t, replOutput(repl, ":place 7 1 1"), "isn't empty")
+	assert.Contains(t, replOutput(repl, ":place 7 50 1"), "outside the arena")
+	assert.Contains(t, replOutput(repl, ":bot 10"), "no bot 10")
+	assert.Contains(t, replOutput(repl, ":bot x"), "isn't a number")
+	assert.Contains(t, replOutput(repl, ":place 1"), "takes 3 arguments")
+	assert.Contains(t, replOutput(repl, ":fnord"), "unknown command")
+
+	replOutput(repl, ":kill 5", ":kill 6", ":kill 8", ":kill 9")
+	assert.Equal(t, "=> 0\n", replOutput(repl, "(alive-allies)"))
+	replOutput(repl, ":revive 9")
+	assert.Equal(t, "=> 1\n", replOutput(repl, "(alive-allies)"))
+
+	state := replOutput(repl, ":state")
+	assert.Contains(t, state, "* bot 7 (team B): (8, 3), alive")
+	assert.Contains(t, state, "  bot 8 (team B): (10, 4), dead")
+
+	assert.Equal(t, strings.Join([]string{
+		"............",
+		".0..........",
+		".1..........",
+		"A2...#..7..B",
+		".3..........",
+		".4........9.",
+		"............",
+	}, "\n") + "\n", replOutput(repl, ":map"))
+
+	assert.False(t, repl.Execute(":quit"))
+}
+
+func TestReplTicks(t *testing.T) {
+	repl := NewRepl(smallTestArena(), &bytes.Buffer{})
+	script := filepath.Join(t.TempDir(), "east.l")
+	assert.NoError(t, os.WriteFile(script, []byte("(move 2)"), 0644))
+
+	// Team A's east is south on the map, so bot 0 walks down the column.
+	replOutput(repl, ":kill 1", ":kill 2", ":kill 3", ":kill 4")
+	output := replOutput(repl, ":script A " + script, ":tick 2")
+	assert.Equal(t, "Tick 2. Scores: A 0, B 0\n", output)
+	assert.Equal(t, 0, repl.State.CurrentBot.Id)
+	assert.Equal(t, "=> 3\n", replOutput(repl, "(my-x-pos)"))
+	assert.Equal(t, 1, repl.State.Bots[5].Position.Y)
+
+	replOutput(repl, ":kill 0")
+	assert.Equal(t, "The game is over.\nTick 2. Scores: A 0, B 0\n", replOutput(repl, ":tick"))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"html"
 	"io"
 	"os"
 	"os/exec"
@@ -30,12 +31,19 @@ func (rv *ResultsViewer) GenerateResults() {
 	rv.Output = file
 	defer file.Close()
 
+	// Measuring the shapes means parsing every script in the generation, so we only do it once for each one.
+	shapes := make([]ShapeStats, rv.GenerationCount + 1)
+	for genId := 1; genId <= rv.GenerationCount; genId++ {
+		shapes[genId] = NewFileManager(rv.Scenario, genId).TreeShapes()
+	}
+
 	rv.WriteHeader()
-	rv.WriteSummary()
+	rv.WriteSummary(shapes)
 	for genId := 1; genId <= rv.GenerationCount; genId++ {
 		gen := NewGeneration(rv.Scenario, genId, rv.Arena)
 
 		rv.WriteBestScores(gen)
+		rv.WriteTreeShapes(shapes[genId])
 		heatmaps := GenerateHeatmaps(gen)
 		rv.WriteHeatmaps(heatmaps)
 	}
@@ -48,6 +56,7 @@ func (rv *ResultsViewer) WriteHeader() {
 		<!DOCTYPE html>
 		<html lang="en">
 		<head>
+			<meta charset="utf-8">
 			<title>Robot Arena Results: %s</title>
 		</head>
 
@@ -56,7 +65,8 @@ func (rv *ResultsViewer) WriteHeader() {
 	`, rv.Scenario, rv.Scenario))
 }
 
-func (rv *ResultsViewer) WriteSummary() {
+// The shapes are indexed by generation.
+func (rv *ResultsViewer) WriteSummary(shapes []ShapeStats) {
 	io.WriteString(rv.Output, `
 		<h3>Summary</h3>
 		<table>
@@ -64,6 +74,8 @@ func (rv *ResultsViewer) WriteSummary() {
 			<th>Generation</th>
 			<th>Successful runs</th>
 			<th>Average script size</th>
+			<th>Average expressions</th>
+			<th>Average depth</th>
 		</tr>
 	`)
 
@@ -81,8 +93,10 @@ func (rv *ResultsViewer) WriteSummary() {
 				<td>%d</td>
 				<td>%d</td>
 				<td>%d</td>
+				<td>%.1f</td>
+				<td>%.1f</td>
 			</tr>
-		`, genId, successes, gen.FileManager.AverageScriptSize()))
+		`, genId, successes, gen.FileManager.AverageScriptSize(), shapes[genId].AverageSize, shapes[genId].AverageDepth))
 	}
 	io.WriteString(rv.Output, `
 		</table>
@@ -96,17 +110,30 @@ func (rv *ResultsViewer) WriteBestScores(gen *Generation) {
 			<tr>
 				<th>Script ID</th>
 				<th>Score</th>
+				<th>Simplified code</th>
+				<th>Explanation</th>
 			</tr>
 	`, gen.Id))
 
 	scores := gen.BestScores()
-	for i := 0; i < SCORES_PER_GENERATION; i++ {
+	for i := 0; i < SCORES_PER_GENERATION && i < len(scores); i++ {
+		var links, code, explanation string
+		if IsHandWritten(scores[i].Id) {
+			links = fmt.Sprintf(`<a href="hand_written/%d.l">hand-written</a>`, -scores[i].Id)
+		} else {
+			links = fmt.Sprintf(`<a href="gen_%d/scripts/%d.l">original</a>, <a href="gen_%d/scripts/simple/%d.l">simplified</a>`,
+			                    gen.Id, scores[i].Id, gen.Id, scores[i].Id)
+			code = rv.simplifiedCode(gen, scores[i].Id)
+			explanation = rv.explanation(gen, scores[i].Id)
+		}
 		io.WriteString(rv.Output, fmt.Sprintf(`
 			<tr>
-				<td>%d (<a href="gen_%d/scripts/%d.l">original</a>, <a href="gen_%d/scripts/simple/%d.l">simplified</a>)</td>
+				<td>%d (%s)</td>
 				<td>%.3f</td>
+				<td>%s</td>
+				<td>%s</td>
 			</tr>
-		`, scores[i].Id, gen.Id, scores[i].Id, gen.Id, scores[i].Id, scores[i].Score))
+		`, scores[i].Id, links, scores[i].Score, code, explanation))
 	}
 
 	io.WriteString(rv.Output, `
@@ -114,6 +141,68 @@ func (rv *ResultsViewer) WriteBestScores(gen *Generation) {
 	`)
 }
 
+// How the sizes of the generation's scripts vary with their depth, folded up like the code.
+func (rv *ResultsViewer) WriteTreeShapes(shapes ShapeStats) {
+	io.WriteString(rv.Output, `
+		<details>
+		<summary>Tree shapes</summary>
+		<table>
+			<tr>
+				<th>Depth</th>
+				<th>Scripts</th>
+				<th>Smallest</th>
+				<th>Average size</th>
+				<th>Largest</th>
+			</tr>
+	`)
+
+	for _, d := range shapes.Depths {
+		io.WriteString(rv.Output, fmt.Sprintf(`
+			<tr>
+				<td>%d</td>
+				<td>%d</td>
+				<td>%d</td>
+				<td>%.1f</td>
+				<td>%d</td>
+			</tr>
+		`, d.Depth, d.Scripts, d.MinSize, d.AverageSize, d.MaxSize))
+	}
+
+	io.WriteString(rv.Output, `
+		</table>
+		</details>
+	`)
+}
+
+// The simplified version of a script, folded up so that it doesn't take over the page.
+func (rv *ResultsViewer) simplifiedCode(gen *Generation, id int) string {
+	source, err := os.ReadFile(gen.FileManager.SimpleScriptPath(id))
+	if err != nil {
+		return ""   // It might have been quarantined.
+	}
+	tree, err := ParseScript(string(source))
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(`<details><summary>%d expressions</summary><pre>%s</pre></details>`,
+	                   tree.Size(), html.EscapeString(string(source)))
+}
+
+// The script's decision list, folded up the same way.
+func (rv *ResultsViewer) explanation(gen *Generation, id int) string {
+	source, err := os.ReadFile(gen.FileManager.ScriptPath(id))
+	if err != nil {
+		return ""
+	}
+	tree, err := ParseScript(string(source))
+	if err != nil {
+		return ""
+	}
+	rules := ExplainScript(tree)
+	return fmt.Sprintf(`<details><summary>%d rules</summary><pre>%s</pre></details>`,
+	                   len(rules), html.EscapeString(FormatRules(rules)))
+}
+
 func (rv *ResultsViewer) WriteHeatmaps(heatmaps []*Heatmap) {
 	io.WriteString(rv.Output, `
 		<table>
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -30,6 +31,7 @@ const (
 	Expr NodeType = iota
 	FuncName
 	Int
+	Program   // The root of a script with subroutines. Children[0] is the main body; Children[n+1] is subroutine n.
 )
 
 type ScriptNode struct {
@@ -41,21 +43,178 @@ type ScriptNode struct {
 
 type Script struct {
 	Code *ScriptNode
+	Compiled CompiledNode   // If present, Run uses this instead of walking Code.
 	State *GameState
+	Budget int        // The maximum number of nodes we'll evaluate per tick. Zero means no limit.
+	OverBudget bool   // True if the last call to Run was stopped for exceeding the budget.
+	Tracer *Tracer    // If present, Run records every node it evaluates.
+	path []*ScriptNode
+	steps int
+	depth int
+
+	// Subroutine state. Only one of subroutines and compiledSubroutines will be set, depending on how we're running.
+	subroutines []*ScriptNode
+	compiledSubroutines []CompiledNode
+	level int          // The number of the subroutine we're in, or NUM_SUBROUTINES if we're in the main body.
+	args StrictArgs    // The arguments to the current subroutine.
+}
+
+// The default per-tick evaluation budget. It can be overridden with the EVAL_BUDGET environment variable.
+const DEFAULT_EVAL_BUDGET = 500
+
+// How deeply nested the evaluation can get before we give up on the script.
+const MAX_EVAL_DEPTH = 200
+
+var EvalBudget = DEFAULT_EVAL_BUDGET
+
+var ErrOverBudget = errors.New("Script exceeded its evaluation budget")
+var ErrTooDeep = errors.New("Script exceeded the maximum evaluation depth")
+var ResultOverBudget = Result{Type: ResultError, Err: ErrOverBudget}
+var ResultTooDeep = Result{Type: ResultError, Err: ErrTooDeep}
+
+func NewScript(code *ScriptNode, state *GameState) Script {
+	return Script{Code: code, Compiled: CompileScript(code), State: state, Budget: EvalBudget}
 }
 
-// If the script returns a number instead of performing an action, just wait.
+// If the script returns a number instead of performing an action, just wait. Same goes for scripts that take too long.
 func (s *Script) Run() Result {
-	result := s.Eval(s.Code)
+	var result Result
+	s.steps, s.depth, s.level, s.args = 0, 0, 0, StrictArgs{}
+	if s.Tracer != nil {
+		// The compiled code doesn't know about tracing, so we have to walk the tree.
+		s.path = s.path[:0]
+		result = s.Eval(s.Code)
+	} else if s.Compiled != nil {
+		result = s.Compiled(s)
+	} else {
+		result = s.Eval(s.Code)
+	}
+	s.OverBudget = result.Type == ResultError
 	if result.Type != ResultAction {
 		result.Type = ResultAction
 		result.Action = Action{Type: ActionWait}
 	}
+	if s.Tracer != nil {
+		s.Tracer.record(s, s.path, result.Action)
+	}
 	return result
 }
 
-func ParseScript(code string) *ScriptNode {
-	node, _, err := readToken(code)
+// A syntax error in a script, along with where we found it. Lines and columns start at 1.
+type ParseError struct {
+	Line int
+	Column int
+	Token string
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("Line %d, column %d, at end of script: %s", e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("Line %d, column %d, near '%s': %s", e.Line, e.Column, e.Token, e.Message)
+}
+
+func newParseError(source string, offset int, token string, message string) *ParseError {
+	line := 1 + strings.Count(source[:offset], "\n")
+	column := offset - strings.LastIndex(source[:offset], "\n")
+	return &ParseError{line, column, token, message}
+}
+
+// A script is a single expression, optionally preceded by some subroutine definitions like "(defun 0 (+ (arg-0) 1))".
+func ParseScript(code string) (*ScriptNode, error) {
+	p := &parser{code, 0}
+	subroutines := make([]*ScriptNode, NUM_SUBROUTINES)
+	hasSubroutines := false
+
+	for {
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(p.source[p.pos:], "(defun") || firstWord(p.source[p.pos + 1:]) != "defun" {
+			break
+		}
+		n, body, err := p.readDefun()
+		if err != nil {
+			return nil, err
+		}
+		subroutines[n] = body
+		hasSubroutines = true
+	}
+
+	node, err := p.readToken()
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, p.errorAt(p.pos - 1, ")", "Unexpected ')'")
+	} else if node.Type == FuncName {
+		return nil, p.bareSymbolError(node)
+	}
+
+	if err = p.skipSpace(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.source) {
+		token := firstWord(p.source[p.pos:])
+		if token == "" {
+			token = p.source[p.pos:p.pos + 1]
+		}
+		return nil, p.errorAt(p.pos, token, "Unexpected text after the end of the script")
+	}
+
+	if hasSubroutines {
+		// A subroutine that isn't defined just returns 0.
+		for i := range subroutines {
+			if subroutines[i] == nil {
+				subroutines[i] = &ScriptNode{Type: Int, N: 0}
+			}
+		}
+		return &ScriptNode{Type: Program, Children: append([]*ScriptNode{node}, subroutines...)}, nil
+	}
+	return node, nil
+}
+
+// Reads "(defun <number> <body>)" and returns the number and the body.
+func (p *parser) readDefun() (int, *ScriptNode, error) {
+	start := p.pos
+	p.pos += len("(defun")
+	if err := p.skipSpace(); err != nil {
+		return 0, nil, err
+	}
+
+	numberStart := p.pos
+	word := firstWord(p.source[p.pos:])
+	p.pos += len(word)
+	n, err := strconv.Atoi(word)
+	if err != nil || n < 0 || n >= NUM_SUBROUTINES {
+		return 0, nil, p.errorAt(numberStart, word, fmt.Sprintf("Subroutine number must be between 0 and %d", NUM_SUBROUTINES - 1))
+	}
+
+	body, err := p.readToken()
+	if err != nil {
+		return 0, nil, err
+	} else if body == nil {
+		return 0, nil, p.errorAt(start, "defun", "Subroutine has no body!")
+	} else if body.Type == FuncName {
+		return 0, nil, p.bareSymbolError(body)
+	}
+
+	if err := p.skipSpace(); err != nil {
+		return 0, nil, err
+	}
+	if p.pos >= len(p.source) {
+		return 0, nil, p.errorAt(start, "(", "Unterminated expression!")
+	} else if p.source[p.pos] != ')' {
+		return 0, nil, p.errorAt(p.pos, firstWord(p.source[p.pos:]), "Subroutine has more than one body!")
+	}
+	p.pos++
+	return n, body, nil
+}
+
+// For scripts that we generated ourselves, where a parse error means there's a bug in the code.
+func MustParseScript(code string) *ScriptNode {
+	node, err := ParseScript(code)
 	if err != nil {
 		logger.Fatalf("Parse error! %v", err)
 	}
@@ -64,7 +223,7 @@ func ParseScript(code string) *ScriptNode {
 
 // Counts the number of expressions in a ScriptNode tree.
 func (node *ScriptNode) Size() int {
-	if node.Type == Expr {
+	if node.Type == Expr || node.Type == Program {
 		i := 0
 		for _, child := range node.Children {
 			i += child.Size()
@@ -75,82 +234,219 @@ func (node *ScriptNode) Size() int {
 	}
 }
 
-// It's quick! It's dirty! It's a Lisp parser in ~60 lines!
-func readToken(code string) (*ScriptNode, string, error) {
-	var err error
-	code = strings.TrimSpace(code)
-	node := ScriptNode{ Children: make([]*ScriptNode, 0) }
-
-	if code[0] == '(' {
-		code = code[1:]
-		node.Type = Expr
-		for {
-			var child *ScriptNode
-			child, code, err = readToken(code)
-			if err != nil {
-				return nil, code, err
-			} else if child == nil {
-				break
-			} else if len(code) == 0 {
-				return nil, code, fmt.Errorf("Unterminated expression!")
-			}
-			node.Children = append(node.Children, child)
-		}
-		if len(node.Children) == 0 {
-			return nil, code, fmt.Errorf("Found an empty list!")
-		}
-		if node.Children[0].Type != FuncName {
-			return nil, code, fmt.Errorf("Non-symbol in function position! Type %v", node.Children[0].Type)
+// Counts the number of levels of nesting in a ScriptNode tree: a number or `(tick)` is 1 deep, `(move 1)` is 2 deep,
+// and a program is as deep as its deepest body.
+func (node *ScriptNode) Depth() int {
+	switch node.Type {
+	case Program:
+		depth := 0
+		for _, child := range node.Children {
+			depth = intMax(depth, child.Depth())
 		}
+		return depth
+	case Expr:
+		depth := 0
 		for _, child := range node.Children[1:] {
-			if child.Type == FuncName {
-				return nil, code, fmt.Errorf("Symbol '%s' passed as function argument!", child.Func.Name)
+			depth = intMax(depth, child.Depth())
+		}
+		return depth + 1
+	default:
+		return 1
+	}
+}
+
+// It's quick! It's dirty! It's a Lisp parser in ~100 lines!
+type parser struct {
+	source string
+	pos int
+}
+
+// Reads a single expression from the start of `code`, and returns it along with the unread remainder of `code`.
+// Returns a nil node if the first thing in `code` is a closing paren.
+func readToken(code string) (*ScriptNode, string, error) {
+	p := &parser{code, 0}
+	node, err := p.readToken()
+	return node, code[p.pos:], err
+}
+
+func (p *parser) errorAt(offset int, token string, message string) error {
+	return newParseError(p.source, offset, token, message)
+}
+
+// A function name on its own can't be evaluated; it has to be called. The parser has just read the name.
+func (p *parser) bareSymbolError(node *ScriptNode) error {
+	name := node.Func.Name
+	return p.errorAt(p.pos - len(name), name, fmt.Sprintf("'%s' has to be called, like '(%s ...)'", name, name))
+}
+
+// Skips over whitespace and comments. Line comments start with ';' and block comments look like '#| ... |#'. Block
+// comments can be nested, so you can comment out a chunk of code that already has comments in it.
+func (p *parser) skipSpace() error {
+	for p.pos < len(p.source) {
+		switch {
+		case unicode.IsSpace(rune(p.source[p.pos])):
+			p.pos++
+		case p.source[p.pos] == ';':
+			end := strings.IndexByte(p.source[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.source)
+			} else {
+				p.pos += end + 1
 			}
+		case strings.HasPrefix(p.source[p.pos:], "#|"):
+			if err := p.skipBlockComment(); err != nil {
+				return err
+			}
+		default:
+			return nil
 		}
-		if len(node.Children) != 1 + node.Children[0].Func.Arity {
-			return nil, code, fmt.Errorf("Wrong number of arguments to '%s': got %d, expected %d",
-																		node.Children[0].Func.Name, len(node.Children) - 1, node.Children[0].Func.Arity)
+	}
+	return nil
+}
+
+func (p *parser) skipBlockComment() error {
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.source) {
+		if strings.HasPrefix(p.source[p.pos:], "#|") {
+			depth++
+			p.pos += 2
+		} else if strings.HasPrefix(p.source[p.pos:], "|#") {
+			depth--
+			p.pos += 2
+			if depth == 0 {
+				return nil
+			}
+		} else {
+			p.pos++
 		}
+	}
+	return p.errorAt(start, "#|", "Unterminated block comment!")
+}
+
+func firstWord(code string) string {
+	end := strings.IndexFunc(code, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == ';'
+	})
+	if end < 0 {
+		return code
+	}
+	return code[:end]
+}
 
-	} else if code[0] == ')' {
-		return nil, code[1:], nil
+func isNumber(word string) bool {
+	return unicode.IsDigit(rune(word[0])) || (len(word) > 1 && word[0] == '-' && unicode.IsDigit(rune(word[1])))
+}
 
-	} else if unicode.IsDigit(rune(code[0])) {
-		s := string(code[0])
-		for i := 1; i < len(code) - 1 && code[i] != ')' && unicode.IsDigit(rune(code[i])); i++ {
-			s += string(code[i])
-		}
-		var err error
-		node.Type = Int
-		node.N, err = strconv.Atoi(s)
+func (p *parser) readToken() (*ScriptNode, error) {
+	if err := p.skipSpace(); err != nil {
+		return nil, err
+	}
+	if p.pos >= len(p.source) {
+		return nil, p.errorAt(p.pos, "", "Unexpected end of script!")
+	}
+
+	start := p.pos
+	switch p.source[p.pos] {
+	case '(':
+		return p.readList()
+	case ')':
+		p.pos++
+		return nil, nil
+	}
+
+	word := firstWord(p.source[p.pos:])
+	p.pos += len(word)
+	if isNumber(word) {
+		n, err := strconv.Atoi(word)
 		if err != nil {
-			return nil, code, fmt.Errorf("Couldn't convert int string to int: '%s', %v", s, err)
+			return nil, p.errorAt(start, word, fmt.Sprintf("Couldn't convert int string to int: '%s', %v", word, err))
 		}
-		return &node, code[len(s):], nil
+		return &ScriptNode{Type: Int, N: n}, nil
+	}
+
+	function, err := ResolveFunction(word)
+	if err != nil {
+		return nil, p.errorAt(start, word, err.Error())
+	}
+	return &ScriptNode{Type: FuncName, Func: function}, nil
+}
 
-	} else if !unicode.IsSpace(rune(code[0])) {
-		s := string(code[0])
-		for i := 1; i < len(code) - 1 && code[i] != ')' && !unicode.IsSpace(rune(code[i])); i++ {
-			s += string(code[i])
+func (p *parser) readList() (*ScriptNode, error) {
+	start := p.pos
+	p.pos++ // Skip the opening paren.
+	node := &ScriptNode{Type: Expr, Children: make([]*ScriptNode, 0)}
+	childStarts := []int{}
+
+	for {
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.source) {
+			return nil, p.errorAt(start, "(", "Unterminated expression!")
 		}
-		node.Type = FuncName
-		node.Func, err = ResolveFunction(s)
+		childStarts = append(childStarts, p.pos)
+		child, err := p.readToken()
 		if err != nil {
-			return nil, code, err
+			return nil, err
+		} else if child == nil {
+			break
 		}
-		return &node, code[len(s):], nil
+		node.Children = append(node.Children, child)
 	}
 
-	return &node, code, nil
+	if len(node.Children) == 0 {
+		return nil, p.errorAt(start, "()", "Found an empty list!")
+	}
+	if node.Children[0].Type != FuncName {
+		return nil, p.errorAt(childStarts[0], firstWord(p.source[childStarts[0]:]),
+		                      fmt.Sprintf("Non-symbol in function position! Type %v", node.Children[0].Type))
+	}
+	for i, child := range node.Children[1:] {
+		if child.Type == FuncName {
+			return nil, p.errorAt(childStarts[i + 1], child.Func.Name,
+			                      fmt.Sprintf("Symbol '%s' passed as function argument!", child.Func.Name))
+		}
+	}
+	function := node.Children[0].Func
+	if len(node.Children) != 1 + function.Arity {
+		return nil, p.errorAt(childStarts[0], function.Name, fmt.Sprintf("Wrong number of arguments to '%s': got %d, expected %d",
+		                                                                function.Name, len(node.Children) - 1, function.Arity))
+	}
+	return node, nil
+}
+
+// Charges one step against the script's budget. Returns false if it's run out.
+func (s *Script) step() bool {
+	s.steps++
+	return s.Budget <= 0 || s.steps <= s.Budget
 }
 
 func (s *Script) Eval(node *ScriptNode) Result {
+	if node.Type == Program {
+		s.subroutines, s.compiledSubroutines, s.level = node.Children[1:], nil, NUM_SUBROUTINES
+		return s.Eval(node.Children[0])
+	}
+	if !s.step() {
+		return ResultOverBudget
+	}
+	if s.Tracer != nil {
+		s.path = append(s.path, node)
+	}
+
 	switch node.Type {
 	case Int:
 		return Result{Type: ResultInt, Int: node.N}
 	case Expr:
+		s.depth++
+		if s.depth > MAX_EVAL_DEPTH {
+			s.depth--
+			return ResultTooDeep
+		}
 		function := node.Children[0].Func
-		return function.Code(s, node.Children[1:])
+		result := function.Code(s, node.Children[1:])
+		s.depth--
+		return result
 	case FuncName:
 		logger.Fatalf("Tried to evaluate a symbol! '%s'", node.Func.Name)
 	}
@@ -160,10 +456,46 @@ func (s *Script) Eval(node *ScriptNode) Result {
 
 // Functions
 
+// Most functions evaluate all of their arguments from left to right, stopping early if one of them returns an action
+// instead of a number. Those are "strict" functions, and they only need to be written in terms of the resulting ints.
+// The rest (if, and, or, not) are special forms which evaluate their own arguments however they like.
+// The arguments are passed in a fixed-size array rather than a slice so that calling a function doesn't allocate.
+type StrictCode func(s *Script, args StrictArgs) Result
+type StrictArgs [MAX_ARITY]int
+
 type Function struct {
 	Name string
 	Arity int
 	Code func(s *Script, args []*ScriptNode) Result
+	Strict StrictCode   // nil for special forms
+	Returns ValueType
+	ArgTypes []ValueType
+}
+
+// No function takes more arguments than this.
+const MAX_ARITY = 3
+
+func NewStrictFunction(name string, returns ValueType, argTypes []ValueType, impl StrictCode) Function {
+	return Function{name, len(argTypes), evalStrictly(impl), impl, returns, argTypes}
+}
+
+func NewSpecialForm(name string, returns ValueType, argTypes []ValueType, code func(s *Script, args []*ScriptNode) Result) Function {
+	return Function{name, len(argTypes), code, nil, returns, argTypes}
+}
+
+// Adapts a strict function for the tree-walking evaluator.
+func evalStrictly(impl StrictCode) func(s *Script, args []*ScriptNode) Result {
+	return func(s *Script, args []*ScriptNode) Result {
+		var values StrictArgs
+		for i, arg := range args {
+			result := s.Eval(arg)
+			if result.Type != ResultInt {
+				return result
+			}
+			values[i] = result.Int
+		}
+		return impl(s, values)
+	}
 }
 
 // Can't use map literal syntax here or we get into recursive initialization.
@@ -171,44 +503,100 @@ var FunctionLookupTable = make(map[string]Function)
 var AllFunctions []Function
 
 func InitScript() {
+	none := []ValueType{}
+	oneNumber := []ValueType{TypeNumber}
+	twoNumbers := []ValueType{TypeNumber, TypeNumber}
+	oneBoolean := []ValueType{TypeBoolean}
+	twoBooleans := []ValueType{TypeBoolean, TypeBoolean}
+	oneDirection := []ValueType{TypeDirection}
+
 	// Base functionality
-	FunctionLookupTable["+"] = Function{"+", 2, RS_Add}
-	FunctionLookupTable["-"] = Function{"-", 2, RS_Subtract}
-	FunctionLookupTable["*"] = Function{"*", 2, RS_Multiply}
-	FunctionLookupTable["/"] = Function{"/", 2, RS_Divide}
-	FunctionLookupTable["mod"] = Function{"mod", 2, RS_Modulus}
-	FunctionLookupTable["<"] = Function{"<", 2, RS_LessThan}
-	FunctionLookupTable[">"] = Function{">", 2, RS_GreaterThan}
-	FunctionLookupTable["="] = Function{"=", 2, RS_Equal}
-	FunctionLookupTable["if"] = Function{"if", 3, RS_If}
-	FunctionLookupTable["and"] = Function{"and", 2, RS_And}
-	FunctionLookupTable["or"] = Function{"or", 2, RS_Or}
-	FunctionLookupTable["not"] = Function{"not", 1, RS_Not}
+	FunctionLookupTable["+"] = NewStrictFunction("+", TypeNumber, twoNumbers, RS_Add)
+	FunctionLookupTable["-"] = NewStrictFunction("-", TypeNumber, twoNumbers, RS_Subtract)
+	FunctionLookupTable["*"] = NewStrictFunction("*", TypeNumber, twoNumbers, RS_Multiply)
+	FunctionLookupTable["/"] = NewStrictFunction("/", TypeNumber, twoNumbers, RS_Divide)
+	FunctionLookupTable["mod"] = NewStrictFunction("mod", TypeNumber, twoNumbers, RS_Modulus)
+	FunctionLookupTable["min"] = NewStrictFunction("min", TypeNumber, twoNumbers, RS_Min)
+	FunctionLookupTable["max"] = NewStrictFunction("max", TypeNumber, twoNumbers, RS_Max)
+	FunctionLookupTable["neg"] = NewStrictFunction("neg", TypeNumber, oneNumber, RS_Negate)
+	FunctionLookupTable["abs"] = NewStrictFunction("abs", TypeNumber, oneNumber, RS_Abs)
+	FunctionLookupTable["rand"] = NewStrictFunction("rand", TypeNumber, oneNumber, RS_Rand)
+	FunctionLookupTable["<"] = NewStrictFunction("<", TypeBoolean, twoNumbers, RS_LessThan)
+	FunctionLookupTable[">"] = NewStrictFunction(">", TypeBoolean, twoNumbers, RS_GreaterThan)
+	FunctionLookupTable["="] = NewStrictFunction("=", TypeBoolean, twoNumbers, RS_Equal)
+	FunctionLookupTable["if"] = NewSpecialForm("if", TypeGeneric, []ValueType{TypeBoolean, TypeGeneric, TypeGeneric}, RS_If)
+	FunctionLookupTable["and"] = NewSpecialForm("and", TypeBoolean, twoBooleans, RS_And)
+	FunctionLookupTable["or"] = NewSpecialForm("or", TypeBoolean, twoBooleans, RS_Or)
+	FunctionLookupTable["not"] = NewSpecialForm("not", TypeBoolean, oneBoolean, RS_Not)
 
 	// Actions
-	FunctionLookupTable["move"] = Function{"move", 1, RS_Move}
-	// Commenting this out for a bit to see if it improves fitness.
-	// FunctionLookupTable["wait"] = Function{"wait", 0, RS_Wait}
-	FunctionLookupTable["shoot"] = Function{"shoot", 1, RS_Shoot}
-	FunctionLookupTable["shoot-nearest"] = Function{"shoot-nearest", 0, RS_ShootNearest}
+	FunctionLookupTable["move"] = NewStrictFunction("move", TypeAction, oneDirection, RS_Move)
+	FunctionLookupTable["wait"] = NewStrictFunction("wait", TypeAction, none, RS_Wait)
+	FunctionLookupTable["shoot"] = NewStrictFunction("shoot", TypeAction, oneDirection, RS_Shoot)
+	FunctionLookupTable["shoot-nearest"] = NewStrictFunction("shoot-nearest", TypeAction, none, RS_ShootNearest)
 
 	// Predicates
-	FunctionLookupTable["can-move?"] = Function{"can-move?", 1, RS_CanMove}
-	FunctionLookupTable["enemy-visible?"] = Function{"enemy-visible?", 0, RS_EnemyVisible}
-	FunctionLookupTable["ally-visible?"] = Function{"ally-visible?", 0, RS_AllyVisible}
-	FunctionLookupTable["enemy-goal-visible?"] = Function{"enemy-goal-visible?", 0, RS_EnemyGoalVisible}
-	FunctionLookupTable["own-goal-visible?"] = Function{"own-goal-visible?", 0, RS_OwnGoalVisible}
+	FunctionLookupTable["can-move?"] = NewStrictFunction("can-move?", TypeBoolean, oneDirection, RS_CanMove)
+	FunctionLookupTable["enemy-visible?"] = NewStrictFunction("enemy-visible?", TypeBoolean, none, RS_EnemyVisible)
+	FunctionLookupTable["ally-visible?"] = NewStrictFunction("ally-visible?", TypeBoolean, none, RS_AllyVisible)
+	FunctionLookupTable["enemy-goal-visible?"] = NewStrictFunction("enemy-goal-visible?", TypeBoolean, none, RS_EnemyGoalVisible)
+	FunctionLookupTable["own-goal-visible?"] = NewStrictFunction("own-goal-visible?", TypeBoolean, none, RS_OwnGoalVisible)
+
+	// Sensors
+	FunctionLookupTable["look"] = NewStrictFunction("look", TypeNumber, oneDirection, RS_Look)
+	FunctionLookupTable["distance"] = NewStrictFunction("distance", TypeNumber, oneDirection, RS_Distance)
+	FunctionLookupTable["enemy-direction"] = NewStrictFunction("enemy-direction", TypeDirection, none, RS_EnemyDirection)
+	FunctionLookupTable["enemy-distance"] = NewStrictFunction("enemy-distance", TypeNumber, none, RS_EnemyDistance)
+	FunctionLookupTable["ally-direction"] = NewStrictFunction("ally-direction", TypeDirection, none, RS_AllyDirection)
+	FunctionLookupTable["ally-distance"] = NewStrictFunction("ally-distance", TypeNumber, none, RS_AllyDistance)
+	FunctionLookupTable["enemy-goal-direction"] = NewStrictFunction("enemy-goal-direction", TypeDirection, none, RS_EnemyGoalDirection)
+	FunctionLookupTable["enemy-goal-distance"] = NewStrictFunction("enemy-goal-distance", TypeNumber, none, RS_EnemyGoalDistance)
+	FunctionLookupTable["own-goal-direction"] = NewStrictFunction("own-goal-direction", TypeDirection, none, RS_OwnGoalDirection)
+	FunctionLookupTable["own-goal-distance"] = NewStrictFunction("own-goal-distance", TypeNumber, none, RS_OwnGoalDistance)
+	FunctionLookupTable["step-toward-enemy-goal"] = NewStrictFunction("step-toward-enemy-goal", TypeDirection, none, RS_StepTowardEnemyGoal)
+	FunctionLookupTable["step-toward-own-goal"] = NewStrictFunction("step-toward-own-goal", TypeDirection, none, RS_StepTowardOwnGoal)
+	FunctionLookupTable["path-distance-to-enemy-goal"] = NewStrictFunction("path-distance-to-enemy-goal", TypeNumber, none, RS_PathDistanceToEnemyGoal)
 
 	// Miscellaneous
-	FunctionLookupTable["tick"] = Function{"tick", 0, RS_Tick}
-	FunctionLookupTable["visible-enemies-count"] = Function{"visible-enemies-count", 0, RS_VisibleEnemiesCount}
-	FunctionLookupTable["visible-allies-count"] = Function{"visible-allies-count", 0, RS_VisibleAlliesCount}
-	FunctionLookupTable["my-x-pos"] = Function{"my-x-pos", 0, RS_MyXPos}
-	FunctionLookupTable["my-y-pos"] = Function{"my-y-pos", 0, RS_MyYPos}
+	FunctionLookupTable["tick"] = NewStrictFunction("tick", TypeNumber, none, RS_Tick)
+	FunctionLookupTable["visible-enemies-count"] = NewStrictFunction("visible-enemies-count", TypeNumber, none, RS_VisibleEnemiesCount)
+	FunctionLookupTable["visible-allies-count"] = NewStrictFunction("visible-allies-count", TypeNumber, none, RS_VisibleAlliesCount)
+	FunctionLookupTable["my-x-pos"] = NewStrictFunction("my-x-pos", TypeNumber, none, RS_MyXPos)
+	FunctionLookupTable["my-y-pos"] = NewStrictFunction("my-y-pos", TypeNumber, none, RS_MyYPos)
+	FunctionLookupTable["my-id"] = NewStrictFunction("my-id", TypeNumber, none, RS_MyId)
+	FunctionLookupTable["alive-allies"] = NewStrictFunction("alive-allies", TypeNumber, none, RS_AliveAllies)
+	FunctionLookupTable["alive-enemies"] = NewStrictFunction("alive-enemies", TypeNumber, none, RS_AliveEnemies)
+	FunctionLookupTable["ticks-remaining"] = NewStrictFunction("ticks-remaining", TypeNumber, none, RS_TicksRemaining)
+	FunctionLookupTable["my-team-score"] = NewStrictFunction("my-team-score", TypeNumber, none, RS_MyTeamScore)
+
+	// Memory
+	FunctionLookupTable["store"] = NewStrictFunction("store", TypeNumber, twoNumbers, RS_Store)
+	FunctionLookupTable["load"] = NewStrictFunction("load", TypeNumber, oneNumber, RS_Load)
+
+	// Communication
+	FunctionLookupTable["broadcast"] = NewStrictFunction("broadcast", TypeNumber, twoNumbers, RS_Broadcast)
+	FunctionLookupTable["listen"] = NewStrictFunction("listen", TypeNumber, oneNumber, RS_Listen)
+
+	// Subroutines
+	subroutineArgs := make([]ValueType, SUBROUTINE_ARITY)
+	for i := range subroutineArgs {
+		subroutineArgs[i] = TypeNumber
+	}
+	for i := 0; i < NUM_SUBROUTINES; i++ {
+		name := fmt.Sprintf("call-%d", i)
+		FunctionLookupTable[name] = NewStrictFunction(name, TypeAction, subroutineArgs, makeCall(i))
+	}
+	for i := 0; i < SUBROUTINE_ARITY; i++ {
+		name := fmt.Sprintf("arg-%d", i)
+		FunctionLookupTable[name] = NewStrictFunction(name, TypeNumber, none, makeArg(i))
+	}
 
 	for _, v := range FunctionLookupTable {
 		AllFunctions = append(AllFunctions, v)
 	}
+	if err := UseScenarioConfig(DefaultScenarioConfig()); err != nil {
+		logger.Fatalf("Bad default config: %v", err)
+	}
 }
 
 func ResolveFunction(name string) (Function, error) {
@@ -219,123 +607,77 @@ func ResolveFunction(name string) (Function, error) {
 	return function, nil
 }
 
-// "Functions" is a poor choice of name, since the functions are responsible for evaluating their own arguments.
-// It's more like a language that has only special forms.
-func RS_Add(s *Script, args []*ScriptNode) Result {
-	result1 := s.Eval(args[0])
-	if result1.Type != ResultInt {
-		return result1
-	}
-	result2 := s.Eval(args[1])
-	if result2.Type != ResultInt {
-		return result2
+func boolResult(b bool) Result {
+	if b {
+		return ResultTrue
+	} else {
+		return ResultFalse
 	}
-	result1.Int += result2.Int
-	return result1
 }
 
-func RS_Subtract(s *Script, args []*ScriptNode) Result {
-	result1 := s.Eval(args[0])
-	if result1.Type != ResultInt {
-		return result1
-	}
-	result2 := s.Eval(args[1])
-	if result2.Type != ResultInt {
-		return result2
-	}
-	result1.Int -= result2.Int
-	return result1
+func RS_Add(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: args[0] + args[1]}
 }
 
-func RS_Multiply(s *Script, args []*ScriptNode) Result {
-	result1 := s.Eval(args[0])
-	if result1.Type != ResultInt {
-		return result1
-	}
-	result2 := s.Eval(args[1])
-	if result2.Type != ResultInt {
-		return result2
-	}
-	result1.Int *= result2.Int
-	return result1
+func RS_Subtract(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: args[0] - args[1]}
+}
+
+func RS_Multiply(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: args[0] * args[1]}
 }
 
 // If we try to divide by zero, we just return zero instead of causing an error.
-func RS_Divide(s *Script, args []*ScriptNode) Result {
-	result1 := s.Eval(args[0])
-	if result1.Type != ResultInt {
-		return result1
-	}
-	result2 := s.Eval(args[1])
-	if result2.Type != ResultInt || result2.Int == 0 {
-		return result2
+func RS_Divide(s *Script, args StrictArgs) Result {
+	if args[1] == 0 {
+		return Result{Type: ResultInt, Int: 0}
 	}
-	result1.Int /= result2.Int
-	return result1
+	return Result{Type: ResultInt, Int: args[0] / args[1]}
 }
 
-func RS_Modulus(s *Script, args []*ScriptNode) Result {
-	result1 := s.Eval(args[0])
-	if result1.Type != ResultInt {
-		return result1
+func RS_Modulus(s *Script, args StrictArgs) Result {
+	if args[1] == 0 {
+		return Result{Type: ResultInt, Int: 0}
 	}
-	result2 := s.Eval(args[1])
-	if result2.Type != ResultInt || result2.Int == 0 {
-		return result2
-	}
-	result1.Int %= result2.Int
-	return result1
+	return Result{Type: ResultInt, Int: args[0] % args[1]}
 }
 
-func RS_LessThan(s *Script, args []*ScriptNode) Result {
-	result1 := s.Eval(args[0])
-	if result1.Type != ResultInt {
-		return result1
-	}
-	result2 := s.Eval(args[1])
-	if result2.Type != ResultInt {
-		return result2
-	}
+func RS_Min(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: intMin(args[0], args[1])}
+}
 
-	if result1.Int < result2.Int {
-		return ResultTrue
-	} else {
-		return ResultFalse
-	}
+func RS_Max(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: intMax(args[0], args[1])}
 }
 
-func RS_GreaterThan(s *Script, args []*ScriptNode) Result {
-	result1 := s.Eval(args[0])
-	if result1.Type != ResultInt {
-		return result1
-	}
-	result2 := s.Eval(args[1])
-	if result2.Type != ResultInt {
-		return result2
-	}
+func RS_Negate(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: -args[0]}
+}
 
-	if result1.Int > result2.Int {
-		return ResultTrue
-	} else {
-		return ResultFalse
-	}
+func RS_Abs(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: intAbs(args[0])}
 }
 
-func RS_Equal(s *Script, args []*ScriptNode) Result {
-	result1 := s.Eval(args[0])
-	if result1.Type != ResultInt {
-		return result1
-	}
-	result2 := s.Eval(args[1])
-	if result2.Type != ResultInt {
-		return result2
+// Random numbers come from the match's RNG, so replaying a match with the same ID gives the same results.
+func RS_Rand(s *Script, args StrictArgs) Result {
+	// The absolute value of the most negative int is still negative, and Intn panics on anything below 1.
+	bound := intAbs(args[0])
+	if bound <= 0 {
+		return Result{Type: ResultInt, Int: 0}
 	}
+	return Result{Type: ResultInt, Int: s.State.Rand.Intn(bound)}
+}
 
-	if result1.Int == result2.Int {
-		return ResultTrue
-	} else {
-		return ResultFalse
-	}
+func RS_LessThan(s *Script, args StrictArgs) Result {
+	return boolResult(args[0] < args[1])
+}
+
+func RS_GreaterThan(s *Script, args StrictArgs) Result {
+	return boolResult(args[0] > args[1])
+}
+
+func RS_Equal(s *Script, args StrictArgs) Result {
+	return boolResult(args[0] == args[1])
 }
 
 func RS_If(s *Script, args []*ScriptNode) Result {
@@ -377,64 +719,38 @@ func RS_Or(s *Script, args []*ScriptNode) Result {
 	return ResultFalse
 }
 
+// Unlike the other functions, 'not' swallows any action that its argument returns.
 func RS_Not(s *Script, args []*ScriptNode) Result {
 	condition := s.Eval(args[0])
-	if condition.Int > 0 {
-		return ResultFalse
-	} else {
-		return ResultTrue
+	if condition.Type == ResultError {
+		return condition
 	}
+	return boolResult(condition.Int <= 0)
 }
 
-func RS_Move(s *Script, args []*ScriptNode) Result {
-	direction := s.Eval(args[0])
-	if direction.Type != ResultInt {
-		return direction
-	}
-
-	dir := relativeToAbsoluteDirection(Direction(direction.Int % int(NumberOfDirections)), s.State.CurrentTeam())
+func RS_Move(s *Script, args StrictArgs) Result {
+	dir := relativeToAbsoluteDirection(Direction(args[0] % int(NumberOfDirections)), s.State.CurrentTeam())
 	destination := s.State.Arena.DestinationCellAfterMove(s.State.CurrentBot.Position, dir)
 	return Result{Type: ResultAction, Action: Action{Type: ActionMove, Target: destination}}
 }
 
-func RS_CanMove(s *Script, args []*ScriptNode) Result {
-	direction := s.Eval(args[0])
-	if direction.Type != ResultInt {
-		return direction
-	}
-
-	dir := relativeToAbsoluteDirection(Direction(direction.Int % int(NumberOfDirections)), s.State.CurrentTeam())
+func RS_CanMove(s *Script, args StrictArgs) Result {
+	dir := relativeToAbsoluteDirection(Direction(args[0] % int(NumberOfDirections)), s.State.CurrentTeam())
 	destination := s.State.Arena.DestinationCellAfterMove(s.State.CurrentBot.Position, dir)
-	if s.State.CellIsEmpty(destination) {
-		return ResultTrue
-	} else {
-		return ResultFalse
-	}
+	return boolResult(s.State.CellIsEmpty(destination))
 }
 
-func RS_Wait(s *Script, args []*ScriptNode) Result {
+func RS_Wait(s *Script, args StrictArgs) Result {
 	return Result{Type: ResultAction, Action: Action{Type: ActionWait}}
 }
 
-func RS_Shoot(s *Script, args []*ScriptNode) Result {
-	direction := s.Eval(args[0])
-	if direction.Type != ResultInt {
-		return direction
-	}
-
-	dir := relativeToAbsoluteDirection(Direction(direction.Int % int(NumberOfDirections)), s.State.CurrentTeam())
-	pos := s.State.CurrentBot.Position
-	var target *Cell
-	switch dir {
-	case North: target = &s.State.Arena.Cells[pos.X * s.State.Arena.Height]
-	case South: target = &s.State.Arena.Cells[pos.X * s.State.Arena.Height + s.State.Arena.Height - 1]
-	case East:  target = &s.State.Arena.Cells[(s.State.Arena.Width - 1) * s.State.Arena.Height + pos.Y]
-	case West:  target = &s.State.Arena.Cells[pos.Y]
-	}
+func RS_Shoot(s *Script, args StrictArgs) Result {
+	dir := relativeToAbsoluteDirection(Direction(args[0] % int(NumberOfDirections)), s.State.CurrentTeam())
+	target := s.State.Arena.EdgeCell(s.State.CurrentBot.Position, dir)
 	return Result{Type: ResultAction, Action: Action{Type: ActionShoot, Target: target}}
 }
 
-func RS_ShootNearest(s *Script, args []*ScriptNode) Result {
+func RS_ShootNearest(s *Script, args StrictArgs) Result {
 	nearestTarget := s.State.NearestVisibleEnemyOrGoal()
 	if nearestTarget == nil {
 		return Result{Type: ResultAction, Action: Action{Type: ActionWait}}
@@ -443,52 +759,119 @@ func RS_ShootNearest(s *Script, args []*ScriptNode) Result {
 	return Result{Type: ResultAction, Action: action}
 }
 
-func RS_Tick(s *Script, args []*ScriptNode) Result {
+func RS_Tick(s *Script, args StrictArgs) Result {
 	return Result{Type: ResultInt, Int: s.State.Tick}
 }
 
-func RS_EnemyVisible(s *Script, args []*ScriptNode) Result {
-	if s.State.CountVisibleEnemiesAndGoals() > 0 { // This could be optimized to short-circuit if necessary.
-		return ResultTrue
-	} else {
-		return ResultFalse
-	}
+func RS_EnemyVisible(s *Script, args StrictArgs) Result {
+	return boolResult(s.State.CountVisibleEnemiesAndGoals() > 0) // This could be optimized to short-circuit if necessary.
 }
 
-func RS_AllyVisible(s *Script, args []*ScriptNode) Result {
-	if s.State.CountVisibleAlliesAndGoals() > 0 { // This could be optimized to short-circuit if necessary.
-		return ResultTrue
-	} else {
-		return ResultFalse
-	}
+func RS_AllyVisible(s *Script, args StrictArgs) Result {
+	return boolResult(s.State.CountVisibleAlliesAndGoals() > 0) // This could be optimized to short-circuit if necessary.
 }
 
-func RS_VisibleEnemiesCount(s *Script, args []*ScriptNode) Result {
+func RS_VisibleEnemiesCount(s *Script, args StrictArgs) Result {
 	return Result{Type: ResultInt, Int: s.State.CountVisibleEnemiesAndGoals()}
 }
 
-func RS_VisibleAlliesCount(s *Script, args []*ScriptNode) Result {
+func RS_VisibleAlliesCount(s *Script, args StrictArgs) Result {
 	return Result{Type: ResultInt, Int: s.State.CountVisibleAlliesAndGoals()}
 }
 
-func RS_EnemyGoalVisible(s *Script, args []*ScriptNode) Result {
-	if s.State.GoalVisible(s.State.OpposingTeam()) {
-		return ResultTrue
-	} else {
-		return ResultFalse
+func RS_EnemyGoalVisible(s *Script, args StrictArgs) Result {
+	return boolResult(s.State.GoalVisible(s.State.OpposingTeam()))
+}
+
+func RS_OwnGoalVisible(s *Script, args StrictArgs) Result {
+	return boolResult(s.State.GoalVisible(s.State.CurrentTeam()))
+}
+
+func RS_Look(s *Script, args StrictArgs) Result {
+	dir := relativeToAbsoluteDirection(Direction(args[0] % int(NumberOfDirections)), s.State.CurrentTeam())
+	what, _ := s.State.Look(dir)
+	return Result{Type: ResultInt, Int: what}
+}
+
+func RS_Distance(s *Script, args StrictArgs) Result {
+	dir := relativeToAbsoluteDirection(Direction(args[0] % int(NumberOfDirections)), s.State.CurrentTeam())
+	_, distance := s.State.Look(dir)
+	return Result{Type: ResultInt, Int: distance}
+}
+
+// Returns the team-relative direction from the current bot to the target, or -1 if there's no target.
+func directionResult(s *Script, target *Cell) Result {
+	if target == nil {
+		return Result{Type: ResultInt, Int: -1}
 	}
+	dir := s.State.Arena.DirectionTo(s.State.CurrentBot.Position, target)
+	return Result{Type: ResultInt, Int: int(absoluteToRelativeDirection(dir, s.State.CurrentTeam()))}
 }
 
-func RS_OwnGoalVisible(s *Script, args []*ScriptNode) Result {
-	if s.State.GoalVisible(s.State.CurrentTeam()) {
-		return ResultTrue
-	} else {
-		return ResultFalse
+// Returns the distance from the current bot to the target, or -1 if there's no target.
+func distanceResult(s *Script, target *Cell) Result {
+	if target == nil {
+		return Result{Type: ResultInt, Int: -1}
 	}
+	return Result{Type: ResultInt, Int: s.State.Arena.Distance(s.State.CurrentBot.Position, target)}
+}
+
+func RS_EnemyDirection(s *Script, args StrictArgs) Result {
+	return directionResult(s, s.State.NearestVisibleBot(s.State.OpposingTeam()))
+}
+
+func RS_EnemyDistance(s *Script, args StrictArgs) Result {
+	return distanceResult(s, s.State.NearestVisibleBot(s.State.OpposingTeam()))
+}
+
+func RS_AllyDirection(s *Script, args StrictArgs) Result {
+	return directionResult(s, s.State.NearestVisibleBot(s.State.CurrentTeam()))
+}
+
+func RS_AllyDistance(s *Script, args StrictArgs) Result {
+	return distanceResult(s, s.State.NearestVisibleBot(s.State.CurrentTeam()))
+}
+
+// Goals never move, so the bots always know where they are, even if they can't see them.
+func RS_EnemyGoalDirection(s *Script, args StrictArgs) Result {
+	return directionResult(s, s.State.Goals[s.State.OpposingTeam()].Position)
+}
+
+func RS_EnemyGoalDistance(s *Script, args StrictArgs) Result {
+	return distanceResult(s, s.State.Goals[s.State.OpposingTeam()].Position)
+}
+
+func RS_OwnGoalDirection(s *Script, args StrictArgs) Result {
+	return directionResult(s, s.State.Goals[s.State.CurrentTeam()].Position)
+}
+
+func RS_OwnGoalDistance(s *Script, args StrictArgs) Result {
+	return distanceResult(s, s.State.Goals[s.State.CurrentTeam()].Position)
+}
+
+// Returns the team-relative direction of the next step toward a goal, or -1 if it can't be reached.
+func stepResult(s *Script, goalTeam Team) Result {
+	dir, found := s.State.StepTowardGoal(goalTeam)
+	if !found {
+		return Result{Type: ResultInt, Int: -1}
+	}
+	return Result{Type: ResultInt, Int: int(dir)}
+}
+
+func RS_StepTowardEnemyGoal(s *Script, args StrictArgs) Result {
+	return stepResult(s, s.State.OpposingTeam())
+}
+
+func RS_StepTowardOwnGoal(s *Script, args StrictArgs) Result {
+	return stepResult(s, s.State.CurrentTeam())
+}
+
+func RS_PathDistanceToEnemyGoal(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: s.State.Arena.PathDistance(s.State.CurrentBot.Position, s.State.OpposingTeam())}
 }
 
 // We have to rotate it 90 degrees so that X increasing is consistently east and Y increasing is consistently south, no matter which team you're on. (Yes, it's confusing. Imagine it from the perspective of the bot, looking towards the enemy goal.)
-func RS_MyXPos(s *Script, args []*ScriptNode) Result {
+func RS_MyXPos(s *Script, args StrictArgs) Result {
 	pos := s.State.CurrentBot.Position.Y
 	if s.State.CurrentTeam() == TeamA {
 		return Result{Type: ResultInt, Int: pos}
@@ -497,7 +880,7 @@ func RS_MyXPos(s *Script, args []*ScriptNode) Result {
 	}
 }
 
-func RS_MyYPos(s *Script, args []*ScriptNode) Result {
+func RS_MyYPos(s *Script, args StrictArgs) Result {
 	pos := s.State.CurrentBot.Position.X
 	if s.State.CurrentTeam() == TeamA {
 		return Result{Type: ResultInt, Int: pos}
@@ -505,3 +888,90 @@ func RS_MyYPos(s *Script, args []*ScriptNode) Result {
 		return Result{Type: ResultInt, Int: s.State.Arena.Width - pos}
 	}
 }
+
+// Team B's bots are numbered 5-9 internally, but each team should see the same IDs.
+func RS_MyId(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: s.State.CurrentBot.Id % BOTS_PER_TEAM}
+}
+
+func RS_AliveAllies(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: s.State.CountLivingBots(s.State.CurrentTeam())}
+}
+
+func RS_AliveEnemies(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: s.State.CountLivingBots(s.State.OpposingTeam())}
+}
+
+func RS_TicksRemaining(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: MAX_TICKS_PER_GAME - s.State.Tick}
+}
+
+func RS_MyTeamScore(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: s.State.Scores[s.State.CurrentTeam()]}
+}
+
+// Slot numbers outside the range of registers wrap around, the same way directions do.
+func memorySlot(n int) int {
+	return intAbs(n) % MEMORY_REGISTERS
+}
+
+// Stores a value in one of the bot's registers, where it persists until the end of the match. Returns the value.
+func RS_Store(s *Script, args StrictArgs) Result {
+	s.State.CurrentBot.Memory[memorySlot(args[0])] = args[1]
+	return Result{Type: ResultInt, Int: args[1]}
+}
+
+func RS_Load(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: s.State.CurrentBot.Memory[memorySlot(args[0])]}
+}
+
+func blackboardChannel(n int) int {
+	return intAbs(n) % BLACKBOARD_CHANNELS
+}
+
+// Writes a value to a channel on the team's shared blackboard, where all of the bot's allies can read it. Returns the
+// value.
+func RS_Broadcast(s *Script, args StrictArgs) Result {
+	s.State.Broadcast(blackboardChannel(args[0]), args[1])
+	return Result{Type: ResultInt, Int: args[1]}
+}
+
+func RS_Listen(s *Script, args StrictArgs) Result {
+	return Result{Type: ResultInt, Int: s.State.Listen(blackboardChannel(args[0]))}
+}
+
+// Scripts can have a few subroutines ("automatically defined functions" in genetic programming jargon) so that useful
+// behaviours can evolve once and be reused from many places. To avoid infinite recursion, a subroutine can only call
+// lower-numbered subroutines. Calling any other subroutine just returns 0, the same as calling one that doesn't exist,
+// and so does using an argument outside of a subroutine. That way any piece of code is valid anywhere in the script,
+// and we don't have to be careful about where we put things when mutating and splicing.
+const NUM_SUBROUTINES = 2
+const SUBROUTINE_ARITY = 2
+
+func makeCall(n int) StrictCode {
+	return func(s *Script, args StrictArgs) Result {
+		if n >= s.level || n >= len(s.subroutines) + len(s.compiledSubroutines) {
+			return Result{Type: ResultInt, Int: 0}
+		}
+
+		oldLevel, oldArgs := s.level, s.args
+		s.level, s.args = n, args
+		var result Result
+		if s.compiledSubroutines != nil {
+			result = s.compiledSubroutines[n](s)
+		} else {
+			result = s.Eval(s.subroutines[n])
+		}
+		s.level, s.args = oldLevel, oldArgs
+		return result
+	}
+}
+
+func makeArg(n int) StrictCode {
+	return func(s *Script, args StrictArgs) Result {
+		if s.level >= NUM_SUBROUTINES {
+			return Result{Type: ResultInt, Int: 0}
+		}
+		return Result{Type: ResultInt, Int: s.args[n]}
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"image"
+	"image/color"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -123,30 +126,81 @@ func TestArityErrors(t *testing.T) {
 }
 
 func TestScriptNodeSize(t *testing.T) {
-	foo := ParseScript("(if 1 2 3)")
-	bar := ParseScript("(if (and 1 2) 3 4)")
+	foo := MustParseScript("(if 1 2 3)")
+	bar := MustParseScript("(if (and 1 2) 3 4)")
 
 	assert.Equal(t, 4, foo.Size())
 	assert.Equal(t, 6, bar.Size())
 }
 
+func TestScriptNodeDepth(t *testing.T) {
+	assert.Equal(t, 1, MustParseScript("7").Depth())
+	assert.Equal(t, 2, MustParseScript("(if 1 2 3)").Depth())
+	assert.Equal(t, 3, MustParseScript("(if (and 1 2) 3 4)").Depth())
+	assert.Equal(t, 3, MustParseScript("(defun 0 (move (+ 1 (tick)))) (shoot-nearest)").Depth())
+}
+
 func TestAddNumbers(t *testing.T) {
 	code := "(+ 13 2)"
 	node, _, err := readToken(code)
 	assert.NoError(t, err)
 
-	script := Script{nil, nil}
+	script := Script{}
 	result := script.Eval(node)
 	assert.Equal(t, ResultInt, result.Type)
 	assert.Equal(t, 15, result.Int)
 }
 
+func TestMoreMath(t *testing.T) {
+	tests := map[string]int{
+		"(min 3 7)": 3,
+		"(min 7 -3)": -3,
+		"(max 3 7)": 7,
+		"(max -7 -3)": -3,
+		"(neg 5)": -5,
+		"(neg -5)": 5,
+		"(abs -5)": 5,
+		"(abs 5)": 5,
+	}
+
+	for code, expected := range tests {
+		script := Script{}
+		result := script.Eval(MustParseScript(code))
+		assert.Equal(t, ResultInt, result.Type, code)
+		assert.Equal(t, expected, result.Int, code)
+	}
+}
+
+func TestRand(t *testing.T) {
+	arena := smallTestArena()
+	rolls := func(seed int64) []int {
+		state := NewGameState(arena)
+		state.CurrentBot = &state.Bots[0]
+		state.Rand = rand.New(rand.NewSource(seed))
+		results := make([]int, 50)
+		for i := range results {
+			results[i] = evalWithState(t, state, "(rand -6)")
+			assert.True(t, results[i] >= 0 && results[i] < 6)
+		}
+		return results
+	}
+
+	// The same seed always gives the same numbers.
+	assert.Equal(t, rolls(42), rolls(42))
+	assert.NotEqual(t, rolls(42), rolls(43))
+
+	state := NewGameState(arena)
+	assert.Equal(t, 0, evalWithState(t, state, "(rand 0)"))
+	// 2^32 * 2^31 overflows to the most negative int, which has no positive absolute value.
+	assert.Equal(t, 0, evalWithState(t, state, "(rand (* 4294967296 2147483648))"))
+}
+
 func TestIf(t *testing.T) {
 	code := "(if 4 1 2)"
 	node, _, err := readToken(code)
 	assert.NoError(t, err)
 
-	script := Script{nil, nil}
+	script := Script{}
 	result := script.Eval(node)
 	assert.Equal(t, ResultInt, result.Type)
 	assert.Equal(t, 1, result.Int)
@@ -165,7 +219,7 @@ func TestLessThan(t *testing.T) {
 	node, _, err := readToken(code)
 	assert.NoError(t, err)
 
-	script := Script{nil, nil}
+	script := Script{}
 	result := script.Eval(node)
 	assert.Equal(t, ResultInt, result.Type)
 	assert.Equal(t, 1, result.Int)
@@ -184,7 +238,7 @@ func TestGreaterThan(t *testing.T) {
 	node, _, err := readToken(code)
 	assert.NoError(t, err)
 
-	script := Script{nil, nil}
+	script := Script{}
 	result := script.Eval(node)
 	assert.Equal(t, ResultInt, result.Type)
 	assert.Equal(t, 0, result.Int)
@@ -203,7 +257,7 @@ func TestEqual(t *testing.T) {
 	node, _, err := readToken(code)
 	assert.NoError(t, err)
 
-	script := Script{nil, nil}
+	script := Script{}
 	result := script.Eval(node)
 	assert.Equal(t, ResultInt, result.Type)
 	assert.Equal(t, 0, result.Int)
@@ -222,7 +276,7 @@ func TestAnd(t *testing.T) {
 	node, _, err := readToken(code)
 	assert.NoError(t, err)
 
-	script := Script{nil, nil}
+	script := Script{}
 	result := script.Eval(node)
 	assert.Equal(t, ResultInt, result.Type)
 	assert.Equal(t, 2, result.Int)
@@ -249,7 +303,7 @@ func TestOr(t *testing.T) {
 	node, _, err := readToken(code)
 	assert.NoError(t, err)
 
-	script := Script{nil, nil}
+	script := Script{}
 	result := script.Eval(node)
 	assert.Equal(t, ResultInt, result.Type)
 	assert.Equal(t, 0, result.Int)
@@ -276,7 +330,7 @@ func TestNot(t *testing.T) {
 	node, _, err := readToken(code)
 	assert.NoError(t, err)
 
-	script := Script{nil, nil}
+	script := Script{}
 	result := script.Eval(node)
 	assert.Equal(t, ResultInt, result.Type)
 	assert.Equal(t, 1, result.Int)
@@ -290,3 +344,362 @@ func TestNot(t *testing.T) {
 	assert.Equal(t, 0, result.Int)
 }
 
+
+func TestStoreAndLoad(t *testing.T) {
+	bot := &Bot{}
+	script := Script{State: &GameState{CurrentBot: bot}}
+
+	node, _, err := readToken("(store 3 42)")
+	assert.NoError(t, err)
+	result := script.Eval(node)
+	assert.Equal(t, ResultInt, result.Type)
+	assert.Equal(t, 42, result.Int)
+	assert.Equal(t, 42, bot.Memory[3])
+
+	node, _, err = readToken("(load 3)")
+	assert.NoError(t, err)
+	result = script.Eval(node)
+	assert.Equal(t, ResultInt, result.Type)
+	assert.Equal(t, 42, result.Int)
+
+	// Slots wrap around.
+	node, _, err = readToken("(load 11)")
+	assert.NoError(t, err)
+	result = script.Eval(node)
+	assert.Equal(t, 42, result.Int)
+
+	node, _, err = readToken("(load 0)")
+	assert.NoError(t, err)
+	result = script.Eval(node)
+	assert.Equal(t, 0, result.Int)
+}
+
+func TestBroadcastAndListen(t *testing.T) {
+	state := &GameState{Bots: []Bot{{Team: TeamA, Id: 0}, {Team: TeamA, Id: 1}, {Team: TeamB, Id: 5}}}
+	script := Script{State: state}
+
+	state.CurrentBot = &state.Bots[0]
+	node, _, err := readToken("(broadcast 10 7)")
+	assert.NoError(t, err)
+	result := script.Eval(node)
+	assert.Equal(t, ResultInt, result.Type)
+	assert.Equal(t, 7, result.Int)
+	assert.Equal(t, []Broadcast{{0, 0, TeamA, 2, 7}}, state.Broadcasts)
+
+	// Allies can hear it...
+	state.CurrentBot = &state.Bots[1]
+	node, _, err = readToken("(listen 2)")
+	assert.NoError(t, err)
+	result = script.Eval(node)
+	assert.Equal(t, 7, result.Int)
+
+	// ...but enemies can't.
+	state.CurrentBot = &state.Bots[2]
+	result = script.Eval(node)
+	assert.Equal(t, 0, result.Int)
+}
+
+func TestEvalBudget(t *testing.T) {
+	state := &GameState{Bots: []Bot{{Team: TeamA}}}
+	state.CurrentBot = &state.Bots[0]
+
+	// Evaluates 6 nodes: the 'if', the 'not', the 'store', its two arguments, and the false branch.
+	node, _, err := readToken("(if (not (store 1 2)) 3 4)")
+	assert.NoError(t, err)
+
+	script := Script{Code: node, State: state, Budget: 5}
+	result := script.Run()
+	assert.True(t, script.OverBudget)
+	assert.Equal(t, ActionWait, result.Action.Type)
+
+	script.Budget = 6
+	script.Run()
+	assert.False(t, script.OverBudget)
+}
+
+func TestEvalDepth(t *testing.T) {
+	code := "1"
+	for i := 0; i < MAX_EVAL_DEPTH; i++ {
+		code = "(+ 1 " + code + ")"
+	}
+	node, _, err := readToken(code)
+	assert.NoError(t, err)
+
+	script := Script{Code: node}
+	script.Run()
+	assert.False(t, script.OverBudget)
+
+	script.Code = MustParseScript("(+ 1 " + code + ")")
+	script.Run()
+	assert.True(t, script.OverBudget)
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	_, err := ParseScript("(if (enemy-visible?)\n  (shoot-nearest)\n  (mvoe 0))")
+	var parseErr *ParseError
+	assert.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 3, parseErr.Line)
+	assert.Equal(t, 4, parseErr.Column)
+	assert.Equal(t, "mvoe", parseErr.Token)
+	assert.ErrorContains(t, err, "No such function: 'mvoe'")
+
+	_, err = ParseScript("(move 0\n")
+	assert.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 1, parseErr.Line)
+	assert.Equal(t, 1, parseErr.Column)
+	assert.ErrorContains(t, err, "Unterminated expression")
+
+	_, err = ParseScript("(move 0) (move 1)")
+	assert.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 10, parseErr.Column)
+	assert.ErrorContains(t, err, "Unexpected text after the end of the script")
+
+	_, err = ParseScript(")")
+	assert.ErrorContains(t, err, "Unexpected ')'")
+
+	_, err = ParseScript("  ")
+	assert.ErrorContains(t, err, "Unexpected end of script")
+
+	// A function name on its own would get as far as Eval before anything noticed.
+	_, err = ParseScript("; just a symbol\n  tick\n")
+	assert.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 2, parseErr.Line)
+	assert.Equal(t, 3, parseErr.Column)
+	assert.Equal(t, "tick", parseErr.Token)
+	assert.ErrorContains(t, err, "'tick' has to be called")
+
+	_, err = ParseScript("(defun 0 shoot-nearest) (call-0 1 2)")
+	assert.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 10, parseErr.Column)
+	assert.Equal(t, "shoot-nearest", parseErr.Token)
+
+	_, err = ParseTypedScript("tick")
+	assert.ErrorAs(t, err, &parseErr)
+}
+
+func TestParseNegativeNumbers(t *testing.T) {
+	node, err := ParseScript("(- -3 4)")
+	assert.NoError(t, err)
+	assert.Equal(t, -3, node.Children[1].N)
+	assert.Equal(t, "-", node.Children[0].Func.Name)
+}
+
+func TestComments(t *testing.T) {
+	code := `; Shoot if we can, otherwise charge.
+(if (enemy-visible?) ; anybody there?
+  (shoot-nearest)
+  #| Moving north is always towards
+     the enemy goal. #| (move 1) |# |#
+  (move 0))
+; The end.
+`
+	node, err := ParseScript(code)
+	assert.NoError(t, err)
+	assert.Equal(t, "(if (enemy-visible?)\n  (shoot-nearest)\n  (move 0))\n", FormatScript(node))
+
+	node, err = ParseScript("(move 0;north\n)")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, node.Children[1].N)
+
+	_, err = ParseScript("(move #| 0)")
+	var parseErr *ParseError
+	assert.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 7, parseErr.Column)
+	assert.ErrorContains(t, err, "Unterminated block comment")
+}
+
+func TestSubroutines(t *testing.T) {
+	code := `(defun 0
+  (- (arg-0) (arg-1)))
+
+(defun 1
+  (call-0 (arg-1) 100))
+
+(+ (call-1 0 7)
+   (arg-0))
+`
+	node, err := ParseScript(code)
+	assert.NoError(t, err)
+	assert.Equal(t, Program, node.Type)
+	assert.Equal(t, 1 + NUM_SUBROUTINES, len(node.Children))
+	assert.Equal(t, code, FormatScript(node))
+
+	// Main calls 1, which calls 0. (arg-0) is zero outside of a subroutine.
+	script := Script{Code: node}
+	result := script.Eval(node)
+	assert.Equal(t, ResultInt, result.Type)
+	assert.Equal(t, -93, result.Int)
+
+	// Subroutines can't call themselves or higher-numbered subroutines.
+	node, err = ParseScript("(defun 0 (+ 1 (call-1 2 3))) (defun 1 5) (call-0 0 0)")
+	assert.NoError(t, err)
+	result = script.Eval(node)
+	assert.Equal(t, 1, result.Int)
+
+	// Missing subroutines return 0.
+	node, err = ParseScript("(defun 1 5) (+ (call-0 1 1) (call-1 1 1))")
+	assert.NoError(t, err)
+	result = script.Eval(node)
+	assert.Equal(t, 5, result.Int)
+}
+
+func TestSubroutineParseErrors(t *testing.T) {
+	_, err := ParseScript("(defun 2 1) 1")
+	assert.ErrorContains(t, err, "Subroutine number must be between 0 and 1")
+
+	_, err = ParseScript("(defun 0) 1")
+	assert.ErrorContains(t, err, "Subroutine has no body")
+
+	_, err = ParseScript("(defun 0 1 2) 1")
+	assert.ErrorContains(t, err, "Subroutine has more than one body")
+
+	_, err = ParseScript("(defun 0 1)")
+	assert.ErrorContains(t, err, "Unexpected end of script")
+}
+
+// A tiny arena for testing sensors. It's 12x7 with no walls around the outside. Team A's goal is at (0, 3) and its
+// spawns are at (1, 1) through (1, 5). Team B's goal is at (11, 3) and its spawns are at (10, 1) through (10, 5).
+// There's a single wall at (5, 3).
+func smallTestArena() *Arena {
+	img := image.NewRGBA(image.Rect(0, 0, 12, 7))
+	for x := 0; x < 12; x++ {
+		for y := 0; y < 7; y++ {
+			img.Set(x, y, color.RGBA{255, 255, 255, 255})
+		}
+	}
+	for y := 1; y <= 5; y++ {
+		img.Set(1, y, color.RGBA{255, 0, 0, 255})
+		img.Set(10, y, color.RGBA{255, 1, 0, 255})
+	}
+	img.Set(0, 3, color.RGBA{0, 255, 0, 255})
+	img.Set(11, 3, color.RGBA{1, 255, 0, 255})
+	img.Set(5, 3, color.RGBA{0, 0, 0, 255})
+	return NewArena(img)
+}
+
+func evalWithState(t *testing.T, state *GameState, code string) int {
+	node, err := ParseScript(code)
+	assert.NoError(t, err)
+	script := Script{State: state}
+	result := script.Eval(node)
+	assert.Equal(t, ResultInt, result.Type)
+	return result.Int
+}
+
+func TestLookAndDistance(t *testing.T) {
+	arena := smallTestArena()
+	state := NewGameState(arena)
+	state.CurrentBot = &state.Bots[0]
+	state.CurrentBot.Position = &arena.Cells[3 * arena.Height + 3]
+
+	// For team A, north is east, south is west, east is south, and west is north.
+	assert.Equal(t, LookWall, evalWithState(t, state, "(look 0)"))
+	assert.Equal(t, 2, evalWithState(t, state, "(distance 0)"))
+	assert.Equal(t, LookAlly, evalWithState(t, state, "(look 1)"))
+	assert.Equal(t, 2, evalWithState(t, state, "(distance 1)"))
+	assert.Equal(t, LookWall, evalWithState(t, state, "(look 2)"))  // The edge of the map
+	assert.Equal(t, 4, evalWithState(t, state, "(distance 2)"))
+
+	state.Bots[BOTS_PER_TEAM].Position = &arena.Cells[3 * arena.Height + 1]
+	assert.Equal(t, LookEnemy, evalWithState(t, state, "(look 3)"))
+	assert.Equal(t, 2, evalWithState(t, state, "(distance 3)"))
+
+	// Dead bots don't block the view.
+	state.Bots[2].Alive = false
+	state.CurrentBot.Position = &arena.Cells[2 * arena.Height + 3]
+	assert.Equal(t, LookOwnGoal, evalWithState(t, state, "(look 1)"))
+	assert.Equal(t, 2, evalWithState(t, state, "(distance 1)"))
+
+	state.Bots[BOTS_PER_TEAM + 2].Alive = false
+	state.CurrentBot.Position = &arena.Cells[9 * arena.Height + 3]
+	assert.Equal(t, LookEnemyGoal, evalWithState(t, state, "(look 0)"))
+	assert.Equal(t, 2, evalWithState(t, state, "(distance 0)"))
+
+	// Team B sees everything the other way around.
+	state.CurrentBot = &state.Bots[BOTS_PER_TEAM]
+	state.CurrentBot.Position = &arena.Cells[9 * arena.Height + 3]
+	assert.Equal(t, LookOwnGoal, evalWithState(t, state, "(look 1)"))
+	assert.Equal(t, LookWall, evalWithState(t, state, "(look 0)"))
+	assert.Equal(t, 4, evalWithState(t, state, "(distance 0)"))
+}
+
+func TestDirectionSensors(t *testing.T) {
+	arena := smallTestArena()
+	state := NewGameState(arena)
+	state.CurrentBot = &state.Bots[0]
+	state.CurrentBot.Position = &arena.Cells[3 * arena.Height + 5]
+
+	// Everybody else is still on their spawns. The nearest ally is at (1, 5), and the nearest enemy is at (10, 5).
+	assert.Equal(t, 1, evalWithState(t, state, "(ally-direction)"))
+	assert.Equal(t, 2, evalWithState(t, state, "(ally-distance)"))
+	assert.Equal(t, 0, evalWithState(t, state, "(enemy-direction)"))
+	assert.Equal(t, 7, evalWithState(t, state, "(enemy-distance)"))
+
+	// The goals are mostly east-west of us, so the direction goes along that axis.
+	assert.Equal(t, 0, evalWithState(t, state, "(enemy-goal-direction)"))
+	assert.Equal(t, 10, evalWithState(t, state, "(enemy-goal-distance)"))
+	assert.Equal(t, 1, evalWithState(t, state, "(own-goal-direction)"))
+	assert.Equal(t, 5, evalWithState(t, state, "(own-goal-distance)"))
+
+	// Straight up the map is relative west for team A, and relative east for team B.
+	state.Bots[BOTS_PER_TEAM].Position = &arena.Cells[3 * arena.Height + 0]
+	assert.Equal(t, 3, evalWithState(t, state, "(enemy-direction)"))
+	assert.Equal(t, 5, evalWithState(t, state, "(enemy-distance)"))
+	for i := 1; i < BOTS_PER_TEAM; i++ {
+		state.Bots[i].Alive = false
+	}
+	state.CurrentBot = &state.Bots[BOTS_PER_TEAM]
+	assert.Equal(t, 3, evalWithState(t, state, "(enemy-direction)"))
+
+	state.Bots[0].Alive = false
+	assert.Equal(t, -1, evalWithState(t, state, "(enemy-direction)"))
+	assert.Equal(t, -1, evalWithState(t, state, "(enemy-distance)"))
+}
+
+func TestGoalPaths(t *testing.T) {
+	arena := smallTestArena()
+	assert.Equal(t, 0, arena.PathDistance(arena.Goals[TeamB], TeamB))
+	assert.Equal(t, 1, arena.PathDistance(&arena.Cells[10 * arena.Height + 3], TeamB))
+	assert.Equal(t, -1, arena.PathDistance(&arena.Cells[5 * arena.Height + 3], TeamB))  // The wall
+
+	state := NewGameState(arena)
+	state.CurrentBot = &state.Bots[0]
+	state.CurrentBot.Position = &arena.Cells[4 * arena.Height + 3]
+
+	// The wall is directly between us and the enemy goal, so we have to go around it. Both ways are equally short, so
+	// we take the lower-numbered direction.
+	assert.Equal(t, 9, evalWithState(t, state, "(path-distance-to-enemy-goal)"))
+	assert.Equal(t, 2, evalWithState(t, state, "(step-toward-enemy-goal)"))
+	assert.Equal(t, 1, evalWithState(t, state, "(step-toward-own-goal)"))
+
+	// Right next to the goal, we step straight into it.
+	state.CurrentBot.Position = &arena.Cells[10 * arena.Height + 3]
+	assert.Equal(t, 1, evalWithState(t, state, "(path-distance-to-enemy-goal)"))
+	assert.Equal(t, 0, evalWithState(t, state, "(step-toward-enemy-goal)"))
+
+	// Team B sees the same thing from the other side, although the wall is one cell closer to its target.
+	state.CurrentBot = &state.Bots[BOTS_PER_TEAM]
+	state.CurrentBot.Position = &arena.Cells[6 * arena.Height + 3]
+	assert.Equal(t, 8, evalWithState(t, state, "(path-distance-to-enemy-goal)"))
+	assert.Equal(t, 2, evalWithState(t, state, "(step-toward-enemy-goal)"))
+}
+
+func TestIntrospection(t *testing.T) {
+	arena := smallTestArena()
+	state := NewGameState(arena)
+	state.CurrentBot = &state.Bots[BOTS_PER_TEAM + 2]
+	state.Tick = 50
+	state.Scores = [2]int{3, -2}
+	state.Bots[0].Alive = false
+	state.Bots[BOTS_PER_TEAM].Alive = false
+
+	assert.Equal(t, 2, evalWithState(t, state, "(my-id)"))
+	assert.Equal(t, 3, evalWithState(t, state, "(alive-allies)"))
+	assert.Equal(t, 4, evalWithState(t, state, "(alive-enemies)"))
+	assert.Equal(t, MAX_TICKS_PER_GAME - 50, evalWithState(t, state, "(ticks-remaining)"))
+	assert.Equal(t, -2, evalWithState(t, state, "(my-team-score)"))
+
+	state.CurrentBot = &state.Bots[2]
+	assert.Equal(t, 2, evalWithState(t, state, "(my-id)"))
+	assert.Equal(t, 3, evalWithState(t, state, "(my-team-score)"))
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Settings that stay the same for every generation of a scenario. They're written to `scenario/<name>/config.json`
+// the first time the scenario runs, so you can edit that file to try an experiment without rebuilding, and every later
+// generation (and `view`) will keep using the same settings.
+type ScenarioConfig struct {
+	// The functions that the random script generator can use, and how likely it is to pick each one relative to the
+	// others. Functions that aren't listed here never get generated, but scripts can still use them.
+	FunctionWeights map[string]float64 `json:"functionWeights"`
+	// The fraction of randomly generated numbers and directions that will be integers instead of function calls.
+	IntegerPercent float64 `json:"integerPercent"`
+	// If true, scripts that don't type-check get quarantined like scripts that don't parse.
+	StrictTypes bool `json:"strictTypes"`
+	// If true, new scripts that the linter says are useless get thrown away and made again.
+	RejectDegenerateScripts bool `json:"rejectDegenerateScripts"`
+	// If true, new scripts that are equivalent to one that's already in the generation get thrown away and made again.
+	RejectDuplicateScripts bool `json:"rejectDuplicateScripts"`
+	// How likely each mutation operator is to be picked, relative to the others.
+	MutationWeights map[string]float64 `json:"mutationWeights"`
+	// How to combine two scripts: "subtree", "size-fair", or "one-point".
+	Crossover string `json:"crossover"`
+	// How to make brand new random scripts: "wrap", "grow", "full", or "ramped".
+	Initialization string `json:"initialization"`
+	// The range of depths that "grow", "full", and "ramped" pick from for each new script.
+	MinInitialDepth int `json:"minInitialDepth"`
+	MaxInitialDepth int `json:"maxInitialDepth"`
+
+	makers [NumberOfTypes]weightedFunctions    // The functions that can return each type in a subroutine
+	mainMakers [NumberOfTypes]weightedFunctions  // The same, minus `arg-N`, which is always 0 in the main body
+	inSubroutine bool  // Whether the generator is making code for a subroutine right now. See forBody.
+	wrappers [NumberOfTypes]weightedFunctions  // The functions that can return each type and take it as an argument
+	mutationWeights [NumberOfMutationOperators]float64  // MutationWeights, in operator order
+	crossover CrossoverStrategy
+	initialization InitMethod
+	minDepths [NumberOfTypes]int  // The depth of the shallowest expression we can make of each type, or 0 if we can't
+}
+
+type weightedFunctions struct {
+	functions []Function
+	cumulativeWeights []float64
+}
+
+func (w *weightedFunctions) add(function Function, weight float64) {
+	total := weight
+	if len(w.cumulativeWeights) > 0 {
+		total += w.cumulativeWeights[len(w.cumulativeWeights) - 1]
+	}
+	w.functions = append(w.functions, function)
+	w.cumulativeWeights = append(w.cumulativeWeights, total)
+}
+
+// Picks a function at random, in proportion to its weight.
+func (w *weightedFunctions) pick() Function {
+	n := rand.Float64() * w.cumulativeWeights[len(w.cumulativeWeights) - 1]
+	return w.functions[sort.SearchFloat64s(w.cumulativeWeights, n)]
+}
+
+// Like pick, but only considers the functions that pass the test. Returns false if none of them do.
+func (w *weightedFunctions) pickWhere(test func(Function) bool) (Function, bool) {
+	candidates := weightedFunctions{}
+	previous := 0.0
+	for i, function := range w.functions {
+		if test(function) {
+			candidates.add(function, w.cumulativeWeights[i] - previous)
+		}
+		previous = w.cumulativeWeights[i]
+	}
+	if len(candidates.functions) == 0 {
+		return Function{}, false
+	}
+	return candidates.pick(), true
+}
+
+// Functions that exist, but which the generator won't use unless a scenario asks for them.
+var DISABLED_BY_DEFAULT = map[string]bool{
+	"wait": true,  // Scripts seem to do better without it.
+}
+
+// The settings that all generated scripts currently use.
+var CurrentConfig *ScenarioConfig
+
+func DefaultScenarioConfig() *ScenarioConfig {
+	config := &ScenarioConfig{
+		FunctionWeights: make(map[string]float64, len(FunctionLookupTable)),
+		IntegerPercent: INTEGER_PERCENT,
+		Crossover: SizeFairCrossover.String(),
+		Initialization: RampedInit.String(),
+		MinInitialDepth: MIN_INITIAL_DEPTH,
+		MaxInitialDepth: MAX_INITIAL_DEPTH,
+	}
+	for name := range FunctionLookupTable {
+		if !DISABLED_BY_DEFAULT[name] {
+			config.FunctionWeights[name] = 1.0
+		}
+	}
+	config.MutationWeights = make(map[string]float64, NumberOfMutationOperators)
+	for op, name := range MUTATION_OPERATOR_NAMES {
+		config.MutationWeights[name] = 1.0
+		if BLOAT_CONTROL_OPERATORS[MutationOperator(op)] {
+			config.MutationWeights[name] = 2.0   // Most scripts are well below the size limit, so these get scaled down.
+		}
+	}
+	return config
+}
+
+func ScenarioConfigPath(scenario string) string {
+	return fmt.Sprintf("scenario/%s/config.json", scenario)
+}
+
+// Reads the scenario's settings, or saves the default settings for it if it doesn't have any yet.
+func LoadScenarioConfig(scenario string) *ScenarioConfig {
+	path := ScenarioConfigPath(scenario)
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		config := DefaultScenarioConfig()
+		if CurrentHighestGeneration(scenario) > 0 {
+			// This scenario started before we had config files, so none of the newer settings existed either.
+			config.MutationWeights, config.Crossover, config.Initialization = nil, "", ""
+			config.useLegacySettings()
+		}
+		config.Save(scenario)
+		return config
+	} else if err != nil {
+		logger.Fatalf("Couldn't read %s: %v", path, err)
+	}
+
+	config := &ScenarioConfig{}
+	if err := json.Unmarshal(contents, config); err != nil {
+		logger.Fatalf("Couldn't parse %s: %v", path, err)
+	}
+	config.useLegacySettings()
+	return config
+}
+
+// Scenarios from before we had any other mutation operators, crossover strategies, or initialization methods don't
+// say which ones to use. They keep evolving the way they always did, instead of switching partway through their run.
+func (c *ScenarioConfig) useLegacySettings() {
+	if c.MutationWeights == nil {
+		c.MutationWeights = map[string]float64{SubtreeMutation.String(): 1.0}
+	}
+	if c.Crossover == "" {
+		c.Crossover = SubtreeCrossover.String()
+	}
+	if c.Initialization == "" {
+		c.Initialization = WrapInit.String()
+	}
+	if c.MinInitialDepth == 0 && c.MaxInitialDepth == 0 {
+		c.MinInitialDepth, c.MaxInitialDepth = MIN_INITIAL_DEPTH, MAX_INITIAL_DEPTH
+	}
+}
+
+func (c *ScenarioConfig) Save(scenario string) {
+	path := ScenarioConfigPath(scenario)
+	contents, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		logger.Fatalf("Couldn't encode config for %s: %v", path, err)
+	}
+	if err := os.MkdirAll(fmt.Sprintf("scenario/%s", scenario), 0755); err != nil {
+		logger.Fatalf("Failed to create directory scenario/%s: %v", scenario, err)
+	}
+	if err := os.WriteFile(path, append(contents, '\n'), 0644); err != nil {
+		logger.Fatalf("Couldn't write %s: %v", path, err)
+	}
+}
+
+// Makes sure that the generator can actually build scripts out of the given settings, then switches over to them.
+func UseScenarioConfig(c *ScenarioConfig) error {
+	if c.IntegerPercent < 0 || c.IntegerPercent >= 1 {
+		return fmt.Errorf("integerPercent must be at least 0 and less than 1, not %v", c.IntegerPercent)
+	}
+
+	// Sorting the names keeps the generator's choices the same from run to run, since map order is random.
+	names := make([]string, 0, len(c.FunctionWeights))
+	for name := range c.FunctionWeights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.makers, c.mainMakers = [NumberOfTypes]weightedFunctions{}, [NumberOfTypes]weightedFunctions{}
+	c.wrappers = [NumberOfTypes]weightedFunctions{}
+	var concrete [NumberOfTypes]bool
+	for _, name := range names {
+		weight := c.FunctionWeights[name]
+		function, err := ResolveFunction(name)
+		if err != nil {
+			return err
+		}
+		if weight < 0 {
+			return fmt.Errorf("Function '%s' has a negative weight: %v", name, weight)
+		} else if weight == 0 {
+			continue
+		}
+
+		for t := TypeNumber; t < TypeGeneric; t++ {
+			if resolveType(function.Returns, t) != t {
+				continue
+			}
+			c.makers[t].add(function, weight)
+			if !strings.HasPrefix(name, "arg-") {
+				c.mainMakers[t].add(function, weight)
+			}
+			concrete[t] = concrete[t] || function.Returns == t
+			for _, argType := range function.ArgTypes {
+				if resolveType(argType, t) == t {
+					c.wrappers[t].add(function, weight)
+					break
+				}
+			}
+		}
+	}
+
+	// We can always make up a number or a direction, but we need at least one function that makes a boolean or an
+	// action. (`if` doesn't count, since it needs another boolean or action to return.)
+	for _, t := range []ValueType{TypeBoolean, TypeAction} {
+		if !concrete[t] {
+			return fmt.Errorf("At least one function that returns %s %s has to be enabled", article(t), t)
+		}
+	}
+
+	if err := c.resolveMutationWeights(); err != nil {
+		return err
+	}
+	crossover, err := ParseCrossoverStrategy(c.Crossover)
+	if err != nil {
+		return err
+	}
+	c.crossover = crossover
+
+	if err := c.resolveInitialization(); err != nil {
+		return err
+	}
+
+	CurrentConfig = c
+	return nil
+}
+
+func (c *ScenarioConfig) resolveMutationWeights() error {
+	c.mutationWeights = [NumberOfMutationOperators]float64{}
+	total := 0.0
+	for name, weight := range c.MutationWeights {
+		op, err := ParseMutationOperator(name)
+		if err != nil {
+			return err
+		}
+		if weight < 0 {
+			return fmt.Errorf("Mutation operator '%s' has a negative weight: %v", name, weight)
+		}
+		c.mutationWeights[op] = weight
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("At least one mutation operator has to have a weight above 0")
+	}
+	return nil
+}
+
+func (c *ScenarioConfig) resolveInitialization() error {
+	initialization, err := ParseInitMethod(c.Initialization)
+	if err != nil {
+		return err
+	}
+	c.initialization = initialization
+	c.resolveMinDepths()
+
+	// A script of depth 1 can only be a single function call like `(shoot-nearest)`, and that's all there'd be.
+	if c.MinInitialDepth < 2 || c.MinInitialDepth > c.MaxInitialDepth || c.MaxInitialDepth > MAX_DEPTH_PER_SCRIPT {
+		return fmt.Errorf("minInitialDepth and maxInitialDepth must be between 2 and %d, and min can't be more than max, " +
+		                  "not %d and %d", MAX_DEPTH_PER_SCRIPT, c.MinInitialDepth, c.MaxInitialDepth)
+	}
+	if c.MinInitialDepth < c.minDepths[SCRIPT_TYPE] {
+		return fmt.Errorf("The shallowest %s that these functions can make is %d deep, so minInitialDepth must be at " +
+		                  "least that, not %d", SCRIPT_TYPE, c.minDepths[SCRIPT_TYPE], c.MinInitialDepth)
+	}
+	return nil
+}
+
+func (c *ScenarioConfig) resolveMinDepths() {
+	c.minDepths = [NumberOfTypes]int{}
+	c.minDepths[TypeNumber], c.minDepths[TypeDirection] = 1, 1   // We can always make up an integer.
+
+	// Each pass can only make things shallower, so this stops once nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for t := TypeNumber; t < TypeGeneric; t++ {
+			for _, function := range c.makers[t].functions {
+				depth := c.callDepth(function, t)
+				if depth > 0 && (c.minDepths[t] == 0 || depth < c.minDepths[t]) {
+					c.minDepths[t] = depth
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// The depth of the shallowest call to the function that returns type t, or 0 if we can't make one yet.
+func (c *ScenarioConfig) callDepth(function Function, t ValueType) int {
+	depth := 1
+	for _, argType := range function.ArgTypes {
+		argDepth := c.minDepths[resolveType(argType, t)]
+		if argDepth == 0 {
+			return 0
+		}
+		depth = intMax(depth, argDepth + 1)
+	}
+	return depth
+}
+
+// The functions that the generator can use to make type t in the body it's working on.
+func (c *ScenarioConfig) makersOf(t ValueType) *weightedFunctions {
+	return c.bodyMakers(t, c.inSubroutine)
+}
+
+func (c *ScenarioConfig) bodyMakers(t ValueType, subroutine bool) *weightedFunctions {
+	if subroutine {
+		return &c.makers[t]
+	}
+	return &c.mainMakers[t]
+}
+
+// Can we generate a function call that returns this type? If not, the generator has to use a number instead.
+func (c *ScenarioConfig) canMake(t ValueType) bool {
+	for _, function := range c.makersOf(t).functions {
+		if function.Returns == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ScenarioConfig) canWrap(t ValueType) bool {
+	return len(c.wrappers[t].functions) > 0
+}
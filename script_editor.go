@@ -9,10 +9,12 @@ import (
 
 const MIN_EXPRS_PER_SCRIPT = 20
 const MAX_EXPRS_PER_SCRIPT = 1000
+const MAX_DEPTH_PER_SCRIPT = 30  // Deeper than almost any script we generate, but it stops long chains of wrapping.
 const MUTATIONS_PER_SCRIPT = 2   // should this be random?
 const MUTATION_SIZE = 10         // should this be random?
 const MAX_LINE_LEN = 40
-const INTEGER_PERCENT = 0.3  // 30 percent of all randomly generated nodes will be integers.
+const INTEGER_PERCENT = 0.3  // By default, 30 percent of all randomly generated nodes will be integers.
+const MIN_EXPRS_PER_SUBROUTINE = 5
 
 var oneLineFormatStrings = []string{
 	"%s(%s)",
@@ -31,96 +33,233 @@ func RandomScript(minExprs int) string {
 	return FormatScript(RandomTree(minExprs))
 }
 
+// Generates a whole script: a main body of at least minExprs expressions, plus a full set of subroutines.
 func RandomTree(minExprs int) *ScriptNode {
-	script := makeRandomNode()
-	for script.Size() < minExprs {
-		script = wrapNode(script)
+	program := &ScriptNode{Type: Program, Children: []*ScriptNode{RandomExpr(minExprs, SCRIPT_TYPE)}}
+	for i := 0; i < NUM_SUBROUTINES; i++ {
+		program.Children = append(program.Children, forBody(true, func() *ScriptNode {
+			return RandomExpr(MIN_EXPRS_PER_SUBROUTINE, SCRIPT_TYPE)
+		}))
+	}
+	randomlyPruneTree(program)
+	return program
+}
+
+// Generates a single random expression of the given type with at least minExprs expressions in it. (If the scenario
+// doesn't enable any functions that we can wrap around it, it may come out smaller.)
+func RandomExpr(minExprs int, t ValueType) *ScriptNode {
+	script := makeRandomNode(t)
+	for script.Size() < minExprs && CurrentConfig.canWrap(t) {
+		script = wrapNode(script, t)
 	}
 	return script
 }
 
-func makeRandomNode() *ScriptNode {
-	if rand.Float32() < INTEGER_PERCENT {
+// Scripts from before we had subroutines are just a single expression. When we change them, we give them a random
+// set of subroutines so that they can use them from then on.
+func withSubroutines(tree *ScriptNode) *ScriptNode {
+	if tree.Type == Program {
+		return tree
+	}
+	program := &ScriptNode{Type: Program, Children: []*ScriptNode{tree}}
+	for i := 0; i < NUM_SUBROUTINES; i++ {
+		program.Children = append(program.Children, forBody(true, func() *ScriptNode {
+			return RandomExpr(MIN_EXPRS_PER_SUBROUTINE, SCRIPT_TYPE)
+		}))
+	}
+	return program
+}
+
+// Runs make with the generator set up for either a subroutine or the main body. `arg-N` is always 0 in the main body,
+// so the generator only uses it in subroutines. Outside of forBody, the generator makes code for the main body.
+func forBody(subroutine bool, make func() *ScriptNode) *ScriptNode {
+	saved := CurrentConfig.inSubroutine
+	CurrentConfig.inSubroutine = subroutine
+	defer func() { CurrentConfig.inSubroutine = saved }()
+	return make()
+}
+
+// Is the location inside one of the tree's subroutines, rather than its main body?
+func inSubroutine(tree *ScriptNode, location TreeLocation) bool {
+	return tree.Type == Program && !containsNode(tree.Children[0], location.Node)
+}
+
+func makeRandomNode(t ValueType) *ScriptNode {
+	if (t == TypeNumber || t == TypeDirection) && (rand.Float64() < CurrentConfig.IntegerPercent || !CurrentConfig.canMake(t)) {
+		if t == TypeDirection {
+			return &ScriptNode{Type: Int, N: rand.Intn(int(NumberOfDirections))}
+		}
 		return &ScriptNode{Type: Int, N: randomInt()}
 	} else {
-		randFunction := AllFunctions[rand.Intn(len(AllFunctions))]
+		randFunction := CurrentConfig.makersOf(t).pick()
 		node := &ScriptNode{Type: Expr, Children: []*ScriptNode{{Type: FuncName, Func: randFunction}}}
-		for i := 0; i < randFunction.Arity; i++ {
-			node.Children = append(node.Children, makeRandomNode())
+		for _, argType := range randFunction.ArgTypes {
+			node.Children = append(node.Children, makeRandomNode(resolveType(argType, t)))
 		}
 		return node
 	}
 }
 
+// Makes a random number, or a call to a function without arguments that returns type t. Returns nil if the scenario
+// doesn't have any such functions and t isn't something a number can stand in for.
+func randomTerminal(t ValueType) *ScriptNode {
+	terminals := []Function{}
+	for _, function := range CurrentConfig.makersOf(t).functions {
+		if function.Arity == 0 && function.Returns == t {
+			terminals = append(terminals, function)
+		}
+	}
+
+	numeric := t == TypeNumber || t == TypeDirection
+	if numeric && (len(terminals) == 0 || rand.Float64() < CurrentConfig.IntegerPercent) {
+		if t == TypeDirection {
+			return &ScriptNode{Type: Int, N: rand.Intn(int(NumberOfDirections))}
+		}
+		return &ScriptNode{Type: Int, N: randomInt()}
+	} else if len(terminals) == 0 {
+		return nil
+	}
+	function := terminals[rand.Intn(len(terminals))]
+	return &ScriptNode{Type: Expr, Children: []*ScriptNode{{Type: FuncName, Func: function}}}
+}
+
 // A curve that gives us numbers between 0 and 50, with more small numbers (0-5) than large ones.
 // https://www.desmos.com/calculator/onchb78rot
 func randomInt() int {
 	return int(math.Floor(0.00005 * math.Pow(rand.Float64() * 100, 3)))
 }
 
-// Wraps a node in some other multi-argument expression.
-func wrapNode(node *ScriptNode) *ScriptNode {
-	for {
-		fn := AllFunctions[rand.Intn(len(AllFunctions))]
-		if fn.Arity > 0 {
-			insertAt := rand.Intn(fn.Arity)
-			expr := &ScriptNode{Type: Expr, Children: []*ScriptNode{{Type: FuncName, Func: fn}}}
-			for i := 0; i < fn.Arity; i++ {
-				if i == insertAt {
-					expr.Children = append(expr.Children, node)
-				} else {
-					expr.Children = append(expr.Children, makeRandomNode())
-				}
-			}
-			return expr
+// Wraps a node of type t in some other expression that returns the same type.
+func wrapNode(node *ScriptNode, t ValueType) *ScriptNode {
+	fn := CurrentConfig.wrappers[t].pick()
+	slots := []int{}
+	for i, argType := range fn.ArgTypes {
+		if resolveType(argType, t) == t {
+			slots = append(slots, i)
 		}
 	}
-}
-
-func MutateScript(script string) string {
-	tree := ParseScript(script)
-	replacement := RandomTree(MUTATION_SIZE)
-	replaceRandomNode(tree, replacement, 0)
-	randomlyPruneTree(tree)
-	return FormatScript(tree)
-}
 
-func SpliceScripts(scriptA, scriptB string) string {
-	treeA, treeB := ParseScript(scriptA), ParseScript(scriptB)
-	replacement := chooseRandomLocation(treeB).Node
-
-	replaceRandomNode(treeA, replacement, 0)
-	randomlyPruneTree(treeA)
-	return FormatScript(treeA)
+	insertAt := slots[rand.Intn(len(slots))]
+	expr := &ScriptNode{Type: Expr, Children: []*ScriptNode{{Type: FuncName, Func: fn}}}
+	for i, argType := range fn.ArgTypes {
+		if i == insertAt {
+			expr.Children = append(expr.Children, node)
+		} else {
+			expr.Children = append(expr.Children, makeRandomNode(resolveType(argType, t)))
+		}
+	}
+	return expr
 }
 
 // Repeatedly picks a random large-ish branch in the tree and replaces it with something shorter until we get
-// below the limit.
+// below the size limit, then does the same with deep branches until we get below the depth limit. Every way of making
+// or changing a script goes through here, so nothing ever ends up over either limit.
 func randomlyPruneTree(tree *ScriptNode) {
 	for tree.Size() > MAX_EXPRS_PER_SCRIPT {
-		replacement := RandomTree(1)
-		replaceRandomNode(tree, replacement, replacement.Size())
+		location := chooseRandomLocation(tree)
+		replacement := RandomExpr(1, location.Type)
+		if replacement.Size() <= location.Node.Size() {
+			location.Parent.Children[location.Index] = replacement
+		}
+	}
+	for tree.Depth() > MAX_DEPTH_PER_SCRIPT {
+		location := chooseTooDeepLocation(tree)
+		replacement := RandomExpr(1, location.Type)
+		if replacement.Depth() < location.Node.Depth() && replacement.Size() <= location.Node.Size() {
+			location.Parent.Children[location.Index] = replacement
+		}
+	}
+}
+
+// Picks a random branch that's on a path which goes deeper than the limit.
+func chooseTooDeepLocation(tree *ScriptNode) TreeLocation {
+	candidates := []TreeLocation{}
+
+	// Returns the depth of the branch at the location, which is at the given level of the tree. (The main body and the
+	// subroutines are at level 1.)
+	var walk func(location TreeLocation, level int) int
+	walk = func(location TreeLocation, level int) int {
+		depth := 1
+		if location.Node.Type == Expr {
+			for i := 1; i < len(location.Node.Children); i++ {
+				depth = intMax(depth, walk(childLocation(location, i), level + 1) + 1)
+			}
+			if level - 1 + depth > MAX_DEPTH_PER_SCRIPT {
+				candidates = append(candidates, location)
+			}
+		}
+		return depth
 	}
+
+	if tree.Type == Program {
+		for i, body := range tree.Children {
+			walk(TreeLocation{body, tree, i, SCRIPT_TYPE}, 1)
+		}
+	} else {
+		// The root of a bare expression has no parent, so it can't be replaced; only its arguments can.
+		for i := 1; i < len(tree.Children); i++ {
+			walk(childLocation(TreeLocation{tree, nil, 0, SCRIPT_TYPE}, i), 2)
+		}
+	}
+	return candidates[rand.Intn(len(candidates))]
 }
 
 type TreeLocation struct {
 	Node *ScriptNode
 	Parent *ScriptNode
 	Index int
+	Type ValueType   // The type of value that the parent expects to find here
 }
 
 func linearizeChildren(tree *ScriptNode) []TreeLocation {
+	if tree.Type != Program {
+		return linearizeTypedChildren(tree, SCRIPT_TYPE)
+	}
+
+	list := []TreeLocation{}
+	for i, node := range tree.Children {
+		list = append(list, TreeLocation{Node: node, Parent: tree, Index: i, Type: SCRIPT_TYPE})
+		if node.Type == Expr {
+			list = append(list, linearizeTypedChildren(node, SCRIPT_TYPE)...)
+		}
+	}
+	return list
+}
+
+// The branches of the tree that can be copied somewhere else that takes their type. We leave out subroutines that the
+// parser filled in with a 0, and hand-written code that breaks the type rules.
+func copyableBranches(tree *ScriptNode) []TreeLocation {
+	branches := []TreeLocation{}
+	for _, location := range linearizeChildren(tree) {
+		if location.Node.Type != FuncName && typeCheckNode(location.Node, location.Type) == nil {
+			branches = append(branches, location)
+		}
+	}
+	return branches
+}
+
+// The tree's own type is needed to work out the types of the arguments to `if`.
+func linearizeTypedChildren(tree *ScriptNode, treeType ValueType) []TreeLocation {
 	list := []TreeLocation{}
 	for i, node := range tree.Children {
-		location := TreeLocation{Node: node, Parent: tree, Index: i}
+		location := TreeLocation{Node: node, Parent: tree, Index: i, Type: treeType}
+		if i > 0 {
+			location.Type = resolveType(tree.Children[0].Func.ArgTypes[i - 1], treeType)
+		}
 		list = append(list, location)
 		if node.Type == Expr {
-			list = append(list, linearizeChildren(node)...)
+			list = append(list, linearizeTypedChildren(node, location.Type)...)
 		}
 	}
 	return list
 }
 
+// The location of the i'th child of the node at the given location. (Child 0 is the function name.)
+func childLocation(location TreeLocation, i int) TreeLocation {
+	node := location.Node
+	return TreeLocation{node.Children[i], node, i, resolveType(node.Children[0].Func.ArgTypes[i - 1], location.Type)}
+}
+
 func chooseRandomLocation(tree *ScriptNode) TreeLocation {
 	nodes := linearizeChildren(tree)
 	for {
@@ -131,19 +270,22 @@ func chooseRandomLocation(tree *ScriptNode) TreeLocation {
 	}
 }
 
-func replaceRandomNode(tree, replacement *ScriptNode, minSize int) {
-	var randomLocation TreeLocation
-	if minSize > 0 {
-		for {
-			randomLocation = chooseRandomLocation(tree)
-			if randomLocation.Node.Size() >= minSize {
-				break
-			}
+// Puts the replacement somewhere in the tree that expects its type, in place of a node with at least minSize
+// expressions. Returns false if there's nowhere that it fits.
+func replaceRandomNode(tree, replacement *ScriptNode, replacementType ValueType, minSize int) bool {
+	candidates := []TreeLocation{}
+	for _, location := range linearizeChildren(tree) {
+		if location.Node.Type != FuncName && typeFits(location.Type, replacementType) && location.Node.Size() >= minSize {
+			candidates = append(candidates, location)
 		}
-	} else {
-		randomLocation = chooseRandomLocation(tree)
 	}
+	if len(candidates) == 0 {
+		return false
+	}
+
+	randomLocation := candidates[rand.Intn(len(candidates))]
 	randomLocation.Parent.Children[randomLocation.Index] = replacement
+	return true
 }
 
 // When formatting, we want simple expressions (anything where the arguments are all constants or zero-argument
@@ -215,133 +357,16 @@ func recursiveFormat(node *ScriptNode, indentLevel int) string {
 }
 
 func FormatScript(node *ScriptNode) string {
-	return recursiveFormat(node, 0) + "\n"
-}
-
-// The evolution process creates really weird-looking programs with lots of dead code, so let's build a tool
-// to make simplified versions of the scripts so that humans can see how they work.
-
-func SimplifyTree(tree *ScriptNode) {
-	if tree.Type == Expr {
-		switch tree.Children[0].Func.Name {
-		case "if":
-			// If the 'if' condition is constant, replace the 'if' statement with the corresponding branch.
-			isConstant, value := constantValue(tree.Children[1])
-			if isConstant {
-				branch := tree.Children[2]
-				if value == 0 {
-					branch = tree.Children[3]
-				}
-				*tree = *branch
+	if node.Type == Program {
+		var sb strings.Builder
+		for i, subroutine := range node.Children[1:] {
+			if subroutine.Type == Int && subroutine.N == 0 {
+				continue   // That's what the parser fills in for a subroutine that isn't defined.
 			}
+			sb.WriteString(fmt.Sprintf("(defun %d\n  %s)\n\n", i, recursiveFormat(subroutine, 2)))
 		}
+		sb.WriteString(recursiveFormat(node.Children[0], 0) + "\n")
+		return sb.String()
 	}
-
-	// Fold constant values
-	isConstant, value := constantValue(tree)
-	if isConstant {
-		*tree = ScriptNode{Type: Int, N: value}
-	}
-
-	for i := 1; i < len(tree.Children); i++ {
-		isConstant, value := constantValue(tree.Children[i])
-		if isConstant {
-			*tree.Children[i] = ScriptNode{Type: Int, N: value}
-		}
-	}
-}
-
-func constantValue(node *ScriptNode) (bool, int) {
-	if node.Type == Int {
-		return true, node.N
-	} else if node.Type == Expr {
-		switch (node.Children[0].Func.Name) {
-		case "and":
-			if isConstant, values := constantArguments(node); isConstant {
-				if values[0] == 0 {
-					return true, 0
-				}
-				return true, values[1]
-			}
-		case "or":
-			// 'or' is tricky because not all of the arguments have to be constant; we just need one true constant to return.
-			for i := 1; i < len(node.Children); i++ {
-				isConstant, value := constantValue(node.Children[i])
-				if !isConstant {
-					return false, -1
-				}
-				if value != 0 || i == len(node.Children) - 1 {
-					return true, value
-				}
-			}
-				case "+":
-			if isConstant, values := constantArguments(node); isConstant {
-				return true, values[0] + values[1]
-			}
-		case "-":
-			if isConstant, values := constantArguments(node); isConstant {
-				return true, values[0] - values[1]
-			}
-		case "*":
-			if isConstant, values := constantArguments(node); isConstant {
-				return true, values[0] * values[1]
-			}
-		case "/":
-			if isConstant, values := constantArguments(node); isConstant {
-				if values[1] == 0 {
-					return true, 0
-				}
-				return true, values[0] / values[1]
-			}
-		case "mod":
-			if isConstant, values := constantArguments(node); isConstant {
-				if values[1] == 0 {
-					return true, 0
-				}
-				return true, values[0] % values[1]
-			}
-		case "<":
-			if isConstant, values := constantArguments(node); isConstant {
-				if values[0] < values[1] {
-					return true, 1
-				}
-				return true, 0
-			}
-		case ">":
-			if isConstant, values := constantArguments(node); isConstant {
-				if values[0] > values[1] {
-					return true, 1
-				}
-				return true, 0
-			}
-		case "=":
-			if isConstant, values := constantArguments(node); isConstant {
-				if values[0] == values[1] {
-					return true, 1
-				}
-				return true, 0
-			}
-		case "not":
-			if isConstant, values := constantArguments(node); isConstant {
-				if values[0] == 0 {
-					return true, 1
-				}
-				return true, 0
-			}
-		}
-	}
-
-	return false, -1
-}
-
-func constantArguments(node *ScriptNode) (bool, []int) {
-	values := make([]int, len(node.Children) - 1)
-	for i := 1; i < len(node.Children); i++ {
-		isConstant, value := constantValue(node.Children[i])
-		if !isConstant {
-			return false, nil
-		}
-		values[i - 1] = value
-	}
-	return true, values
+	return recursiveFormat(node, 0) + "\n"
 }
@@ -1,48 +1,50 @@
 package main
 
 import (
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestFormatScript1(t *testing.T) {
-	have := ParseScript("(ally-visible?)")
+	have := MustParseScript("(ally-visible?)")
 	expect := "(ally-visible?)\n"
 	// fmt.Printf("have:\n%s\nexpect:\n%s\n", FormatScript(have), expect)
 	assert.Equal(t, expect, FormatScript(have))
 
-	have = ParseScript("(and 1 2)")
+	have = MustParseScript("(and 1 2)")
 	expect = "(and 1 2)\n"
 	// fmt.Printf("have:\n%s\nexpect:\n%s\n", FormatScript(have), expect)
 	assert.Equal(t, expect, FormatScript(have))
 
-	have = ParseScript("(and 1 (+ 2 2))")
+	have = MustParseScript("(and 1 (+ 2 2))")
 	expect = "(and 1\n     (+ 2 2))\n"
 	// fmt.Printf("have:\n%s\nexpect:\n%s\n", FormatScript(have), expect)
 	assert.Equal(t, expect, FormatScript(have))
 
-	have = ParseScript("(move (and 1 2))")
+	have = MustParseScript("(move (and 1 2))")
 	expect = "(move (and 1 2))\n"
 	// fmt.Printf("have:\n%s\nexpect:\n%s\n", FormatScript(have), expect)
 	assert.Equal(t, expect, FormatScript(have))
 
-	have = ParseScript("(move (and 1 (+ 2 2)))")
+	have = MustParseScript("(move (and 1 (+ 2 2)))")
 	expect = "(move (and 1\n           (+ 2 2)))\n"
 	// fmt.Printf("have:\n%s\nexpect:\n%s\n", FormatScript(have), expect)
 	assert.Equal(t, expect, FormatScript(have))
 
-	have = ParseScript("(and (and 1 2) 3)")
+	have = MustParseScript("(and (and 1 2) 3)")
 	expect = "(and (and 1 2)\n     3)\n"
 	// fmt.Printf("have:\n%s\nexpect:\n%s\n", FormatScript(have), expect)
 	assert.Equal(t, expect, FormatScript(have))
 
-	have = ParseScript("(and (and 1 (+ 2 2)) 3)")
+	have = MustParseScript("(and (and 1 (+ 2 2)) 3)")
 	expect = "(and (and 1\n          (+ 2 2))\n     3)\n"
 	// fmt.Printf("have:\n%s\nexpect:\n%s\n", FormatScript(have), expect)
 	assert.Equal(t, expect, FormatScript(have))
 
-	have = ParseScript("(if (or 1 2) (and 2 3) 4)")
+	have = MustParseScript("(if (or 1 2) (and 2 3) 4)")
 	expect = "(if (or 1 2)\n  (and 2 3)\n  4)\n"
 	// fmt.Printf("have:\n%s\nexpect:\n%s\n", FormatScript(have), expect)
  	assert.Equal(t, expect, FormatScript(have))
@@ -70,17 +72,151 @@ func TestSimplifyScript(t *testing.T) {
 		"(not (+ 2 2))": "0\n",
 		"(not (- 2 2))": "1\n",
 		"(shoot (+ 2 2))": "(shoot 4)\n",
+		"(min 3 (+ 2 2))": "3\n",
+		"(max 3 (+ 2 2))": "4\n",
+		"(neg (+ 2 2))": "-4\n",
+		"(abs (- 2 5))": "3\n",
+		"(abs (neg 7))": "7\n",
 
 
 		// Expressions that are not constant should not be simplified.
 		"(if (my-x-pos) (+ 2 2) (- 3 3))": "(if (my-x-pos)\n  4\n  0)\n",
 		"(and (+ 2 (my-x-pos)) (+ 3 3))": "(and (+ 2 (my-x-pos))\n     6)\n",
 		"(or (my-x-pos) (my-x-pos))": "(or (my-x-pos) (my-x-pos))\n",
+		"(rand (+ 2 2))": "(rand 4)\n",
 	}
 
 	for before, after := range tests {
-		code := ParseScript(before)
+		code := MustParseScript(before)
 		SimplifyTree(code)
 		assert.Equal(t, after, FormatScript(code))
 	}
 }
+
+func TestScenarioConfigLimitsGenerator(t *testing.T) {
+	assert.NoError(t, withScenarioConfig(t, func(config *ScenarioConfig) {
+		config.FunctionWeights = map[string]float64{"+": 1, "tick": 3, "wait": 0, "shoot-nearest": 1, "enemy-visible?": 1}
+		config.IntegerPercent = 0.1
+	}))
+
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		tree := &ScriptNode{Type: Program, Children: []*ScriptNode{makeRandomNode(TypeNumber)}}
+		for _, location := range linearizeChildren(tree) {
+			if location.Node.Type == Expr {
+				counts[location.Node.Children[0].Func.Name]++
+			}
+		}
+	}
+	assert.Equal(t, 2, len(counts))
+	assert.Greater(t, counts["tick"], 2 * counts["+"])
+}
+
+func TestArgumentsOnlyInSubroutines(t *testing.T) {
+	usesArgs := func(node *ScriptNode) bool {
+		return containsFunction(node, func(function Function) bool { return strings.HasPrefix(function.Name, "arg-") })
+	}
+	seen := false
+	for i := 0; i < 200; i++ {
+		trees := []*ScriptNode{RandomTree(MIN_EXPRS_PER_SCRIPT), NewRandomTree()}
+		// These are the mutations that make up new code, rather than moving code that's already there.
+		for _, operator := range []MutationOperator{SubtreeMutation, PointMutation, ShrinkMutation} {
+			mutated := copyTree(trees[0])
+			mutateTree(mutated, operator)
+			trees = append(trees, mutated)
+		}
+
+		for _, tree := range trees {
+			assert.False(t, usesArgs(tree.Children[0]), oneLine(tree))
+			for _, subroutine := range tree.Children[1:] {
+				seen = seen || usesArgs(subroutine)
+			}
+		}
+	}
+	assert.True(t, seen)
+}
+
+func TestBadScenarioConfigs(t *testing.T) {
+	functions := func(weights map[string]float64, integerPercent float64) func(*ScenarioConfig) {
+		return func(config *ScenarioConfig) { config.FunctionWeights, config.IntegerPercent = weights, integerPercent }
+	}
+
+	assert.Error(t, withScenarioConfig(t, functions(map[string]float64{"+": 1, "fnord": 1}, 0)))
+	assert.Error(t, withScenarioConfig(t, functions(map[string]float64{"+": -1, "tick": 1}, 0)))
+	assert.Error(t, withScenarioConfig(t, functions(map[string]float64{"tick": 1, "move": 1}, 0)))
+	assert.Error(t, withScenarioConfig(t, functions(map[string]float64{"if": 1, "move": 1}, 0)))
+	assert.Error(t, withScenarioConfig(t, functions(map[string]float64{"move": 1, "<": 1}, 1)))
+	assert.NoError(t, withScenarioConfig(t, functions(map[string]float64{"move": 1, "<": 1}, 0)))
+}
+
+func TestLoadScenarioConfig(t *testing.T) {
+	inTempDir(t)
+	assert.Equal(t, DefaultScenarioConfig(), LoadScenarioConfig("new"))
+	assert.FileExists(t, ScenarioConfigPath("new"))
+
+	// Scenarios that already have generations but no config file keep evolving the way they always did.
+	assert.NoError(t, os.MkdirAll("scenario/old/gen_3", 0755))
+	config := LoadScenarioConfig("old")
+	assert.Equal(t, map[string]float64{"subtree": 1}, config.MutationWeights)
+	assert.Equal(t, "subtree", config.Crossover)
+	assert.Equal(t, "wrap", config.Initialization)
+	assert.Equal(t, config, LoadScenarioConfig("old"))
+
+	// So do ones whose config file is from before these settings existed.
+	assert.NoError(t, os.MkdirAll("scenario/older", 0755))
+	contents := []byte(`{"functionWeights": {"move": 1, "<": 1}, "integerPercent": 0.3}`)
+	assert.NoError(t, os.WriteFile(ScenarioConfigPath("older"), contents, 0644))
+	config = LoadScenarioConfig("older")
+	assert.NoError(t, UseScenarioConfig(config))
+	t.Cleanup(func() { UseScenarioConfig(DefaultScenarioConfig()) })
+	assert.Equal(t, SubtreeMutation, CurrentConfig.pickMutation(10))
+	assert.Equal(t, SubtreeCrossover, CurrentConfig.crossover)
+	assert.Equal(t, WrapInit, CurrentConfig.initialization)
+	assert.Equal(t, MIN_INITIAL_DEPTH, CurrentConfig.MinInitialDepth)
+	assert.Equal(t, MAX_INITIAL_DEPTH, CurrentConfig.MaxInitialDepth)
+}
+
+func TestGeneratedScriptsAreWellTyped(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		tree := RandomTree(MIN_EXPRS_PER_SCRIPT)
+		assert.NoError(t, TypeCheck(tree), FormatScript(tree))
+
+		mutated, _, err := MutateScript(FormatScript(tree))
+		assert.NoError(t, err)
+		assert.NoError(t, TypeCheck(MustParseScript(mutated)), mutated)
+
+		spliced, err := SpliceScripts(mutated, RandomScript(MIN_EXPRS_PER_SCRIPT))
+		assert.NoError(t, err)
+		assert.NoError(t, TypeCheck(MustParseScript(spliced)), spliced)
+	}
+}
+
+func TestLocationTypes(t *testing.T) {
+	tree := MustParseScript("(defun 1 (move (arg-0))) (if (< (tick) 3) (shoot (enemy-direction)) (call-1 2 (tick)))")
+	types := make(map[string]ValueType)
+	for _, location := range linearizeChildren(tree) {
+		if location.Node.Type != FuncName {
+			types[strings.TrimSpace(FormatScript(location.Node))] = location.Type
+		}
+	}
+
+	assert.Equal(t, TypeAction, types["(if (< (tick) 3)\n  (shoot (enemy-direction))\n  (call-1 2 (tick)))"])
+	assert.Equal(t, TypeBoolean, types["(< (tick) 3)"])
+	assert.Equal(t, TypeNumber, types["3"])
+	assert.Equal(t, TypeAction, types["(shoot (enemy-direction))"])
+	assert.Equal(t, TypeDirection, types["(enemy-direction)"])
+	assert.Equal(t, TypeNumber, types["2"])
+	assert.Equal(t, TypeAction, types["(move (arg-0))"])
+	assert.Equal(t, TypeDirection, types["(arg-0)"])
+}
+
+func TestSpliceOnlySwapsCompatibleTypes(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		// The only thing in B that could fit anywhere in A is the whole of B, since A has no numbers or directions.
+		scriptA := "(defun 0 (shoot-nearest)) (defun 1 (wait)) (if (enemy-visible?) (shoot-nearest) (wait))"
+		spliced, err := SpliceScripts(scriptA, "(move (+ 1 2))")
+		assert.NoError(t, err)
+		assert.NoError(t, TypeCheck(MustParseScript(spliced)), spliced)
+		assert.Contains(t, spliced, "(move (+ 1 2))")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Everything in RoboScript is an integer when it runs, but some integers mean very different things than others. The
+// random script generator uses these types so that it doesn't waste its time building nonsense like
+// `(+ (move 1) 3)`, and in strict mode we reject scripts that don't fit them.
+type ValueType uint8
+const (
+	TypeNumber ValueType = iota
+	TypeBoolean
+	TypeDirection
+	TypeAction
+	TypeGeneric   // Whatever type the surrounding expression wants. Only `if` uses this.
+	NumberOfTypes
+)
+
+// The type that a script's main body and each of its subroutines have to return.
+const SCRIPT_TYPE = TypeAction
+
+func (t ValueType) String() string {
+	switch t {
+	case TypeNumber:    return "number"
+	case TypeBoolean:   return "boolean"
+	case TypeDirection: return "direction"
+	case TypeAction:    return "action"
+	case TypeGeneric:   return "anything"
+	}
+	return fmt.Sprintf("type %d", t)
+}
+
+// Can a value of type `got` go in a place that expects type `want`? A direction is just a number that gets wrapped
+// around, so those two can stand in for each other; everything else has to match exactly.
+func typeFits(want, got ValueType) bool {
+	if want == got {
+		return true
+	}
+	return (want == TypeNumber || want == TypeDirection) && (got == TypeNumber || got == TypeDirection)
+}
+
+// Works out what a function's return value or argument type is when it's used in a place that expects type `want`.
+func resolveType(t, want ValueType) ValueType {
+	if t == TypeGeneric {
+		return want
+	}
+	return t
+}
+
+// Checks that every part of the tree returns the kind of value that its parent expects.
+func TypeCheck(tree *ScriptNode) error {
+	if tree.Type == Program {
+		for i, child := range tree.Children {
+			if i > 0 && child.Type == Int && child.N == 0 {
+				continue   // The parser fills in subroutines that the script didn't define with a 0.
+			}
+			if err := typeCheckNode(child, SCRIPT_TYPE); err != nil {
+				if i == 0 {
+					return fmt.Errorf("In the main body: %w", err)
+				}
+				return fmt.Errorf("In subroutine %d: %w", i - 1, err)
+			}
+		}
+		return nil
+	}
+	return typeCheckNode(tree, SCRIPT_TYPE)
+}
+
+func typeCheckNode(node *ScriptNode, want ValueType) error {
+	switch node.Type {
+	case Int:
+		if !typeFits(want, TypeNumber) {
+			return fmt.Errorf("Expected %s %s, but got the number %d", article(want), want, node.N)
+		}
+	case Expr:
+		function := node.Children[0].Func
+		if got := resolveType(function.Returns, want); !typeFits(want, got) {
+			return fmt.Errorf("Expected %s %s, but '%s' returns %s %s", article(want), want, function.Name, article(got), got)
+		}
+		for i, arg := range node.Children[1:] {
+			if err := typeCheckNode(arg, resolveType(function.ArgTypes[i], want)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func article(t ValueType) string {
+	if t == TypeAction || t == TypeGeneric {
+		return "an"
+	}
+	return "a"
+}
+
+// Parses a script, and if the scenario is in strict mode, also makes sure that it's well-typed.
+func ParseTypedScript(code string) (*ScriptNode, error) {
+	tree, err := ParseScript(code)
+	if err != nil {
+		return nil, err
+	}
+	if CurrentConfig.StrictTypes {
+		if err := TypeCheck(tree); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypeCheck(t *testing.T) {
+	good := []string{
+		"(shoot-nearest)",
+		"(move 2)",
+		"(move (enemy-direction))",
+		"(move (+ (enemy-direction) 1))",
+		"(if (and (enemy-visible?) (not (< (tick) 5))) (shoot-nearest) (move (step-toward-enemy-goal)))",
+		"(move (if (can-move? 0) 0 (load 3)))",
+		"(defun 1 (move (arg-0))) (call-1 2 (tick))",
+	}
+	bad := []string{
+		"3",
+		"(tick)",
+		"(enemy-visible?)",
+		"(move (shoot-nearest))",
+		"(if 1 (shoot-nearest) (wait))",
+		"(if (enemy-visible?) (shoot-nearest) 3)",
+		"(move (+ (move 1) 3))",
+		"(move (+ (enemy-visible?) 3))",
+		"(defun 0 (tick)) (shoot-nearest)",
+	}
+
+	for _, code := range good {
+		assert.NoError(t, TypeCheck(MustParseScript(code)), code)
+	}
+	for _, code := range bad {
+		assert.Error(t, TypeCheck(MustParseScript(code)), code)
+	}
+}
+
+func TestTypeErrorMessages(t *testing.T) {
+	err := TypeCheck(MustParseScript("(move (+ (move 1) 3))"))
+	assert.EqualError(t, err, "Expected a number, but 'move' returns an action")
+
+	err = TypeCheck(MustParseScript("(defun 1 (+ 1 2)) (shoot-nearest)"))
+	assert.EqualError(t, err, "In subroutine 1: Expected an action, but '+' returns a number")
+}
+
+func TestStrictMode(t *testing.T) {
+	defer func() { CurrentConfig.StrictTypes = false }()
+	code := "(if (enemy-visible?) (shoot-nearest) (+ 1 2))"
+
+	CurrentConfig.StrictTypes = false
+	_, err := ParseTypedScript(code)
+	assert.NoError(t, err)
+
+	CurrentConfig.StrictTypes = true
+	_, err = ParseTypedScript(code)
+	assert.Error(t, err)
+	_, err = ParseTypedScript("(if (enemy-visible?) (shoot-nearest) (move 1))")
+	assert.NoError(t, err)
+}
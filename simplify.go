@@ -0,0 +1,463 @@
+package main
+
+import (
+	"strings"
+)
+
+// The evolution process creates really weird-looking programs with lots of dead code, so let's build a tool
+// to make simplified versions of the scripts so that humans can see how they work.
+//
+// Every rewrite here has to leave the script doing exactly what it did before, so they're fussier than you might
+// expect: `(* x 0)` is only 0 if x can't take an action or change anything, and `(not (not x))` is only x if x is
+// always 0 or 1. The one thing we don't preserve is how much of the evaluation budget the script uses, since saving
+// that is kind of the point. That means a script that ran out of budget before might finish and act once it's been
+// simplified, so "exactly what it did before" only holds for scripts that finish within the budget.
+
+// Functions that change something when they run, apart from taking an action.
+var EFFECTFUL_FUNCTIONS = map[string]bool{"store": true, "broadcast": true, "rand": true}
+
+type simplifier struct {
+	program *ScriptNode   // nil if the script has no subroutines
+	level int             // The subroutine we're in, or NUM_SUBROUTINES for the main body. See Script.level.
+}
+
+// Simplifies the whole tree in place, from the bottom up.
+func SimplifyTree(tree *ScriptNode) {
+	if tree.Type != Program {
+		// A script without subroutines runs at level 0, so calls and arguments are always 0.
+		(&simplifier{nil, 0}).simplify(tree)
+		return
+	}
+
+	// Subroutines can only call lower-numbered ones, so if we go in order, everything that a piece of code can call
+	// has already been simplified by the time we get to it.
+	for n := 0; n < len(tree.Children) - 1; n++ {
+		(&simplifier{tree, n}).simplify(tree.Children[n + 1])
+	}
+	(&simplifier{tree, NUM_SUBROUTINES}).simplify(tree.Children[0])
+	removeUnusedSubroutines(tree)
+
+	allUnused := true
+	for _, subroutine := range tree.Children[1:] {
+		allUnused = allUnused && isInt(subroutine, 0)
+	}
+	if allUnused {
+		// Nothing can call a subroutine any more, so we don't need them.
+		*tree = *tree.Children[0]
+	}
+}
+
+func (s *simplifier) simplify(node *ScriptNode) {
+	if node.Type != Expr {
+		return
+	}
+	for _, arg := range node.Children[1:] {
+		s.simplify(arg)
+	}
+
+	// One rewrite can make another one possible, like (- 0 (neg x)) -> (neg (neg x)) -> x.
+	for node.Type == Expr {
+		replacement := s.rewrite(node)
+		if replacement == nil {
+			break
+		}
+		*node = *replacement
+	}
+	if isConstant, value := constantValue(node); isConstant {
+		*node = ScriptNode{Type: Int, N: value}
+	}
+}
+
+// Returns a simpler node that does the same thing as this one, or nil if we can't find one. The arguments have
+// already been simplified.
+func (s *simplifier) rewrite(node *ScriptNode) *ScriptNode {
+	function := node.Children[0].Func
+	args := node.Children[1:]
+
+	if function.Strict != nil {
+		// If an argument always takes an action, then nothing after it ever runs, and neither does the function itself.
+		// We can only drop the arguments before it if they don't do anything either.
+		for _, arg := range args {
+			if alwaysActs(arg) {
+				return arg
+			}
+			if hasEffects(arg) {
+				break
+			}
+		}
+	}
+
+	switch function.Name {
+	case "if":
+		condition, yes, no := args[0], args[1], args[2]
+		if alwaysActs(condition) {
+			return condition
+		}
+		if isNot(condition) && isNot(condition.Children[1]) && !canAct(condition.Children[1].Children[1]) {
+			// 'if' only cares whether its condition is greater than zero, and so does 'not'.
+			condition = condition.Children[1].Children[1]
+			node.Children[1] = condition
+		}
+		if isConstant, value := constantValue(condition); isConstant {
+			if value > 0 {
+				return yes
+			}
+			return no
+		}
+		if !hasEffects(condition) && sameCode(yes, no) {
+			return yes
+		}
+		if isInt(yes, 1) && isInt(no, 0) && isZeroOrOne(condition) {
+			return condition
+		}
+
+	case "and":
+		if alwaysActs(args[0]) {
+			return args[0]
+		}
+		if isConstant, value := constantValue(args[0]); isConstant && value != 0 {
+			return args[1]
+		}
+		if isInt(args[1], 0) && !hasEffects(args[0]) {
+			return args[1]
+		}
+
+	case "or":
+		if alwaysActs(args[0]) {
+			return args[0]
+		}
+		// 'or' returns 0 instead of a negative number, so we can only drop a false argument if the other one is 0 or 1.
+		if isConstant, value := constantValue(args[0]); isConstant && value <= 0 && isZeroOrOne(args[1]) {
+			return args[1]
+		}
+		if isConstant, value := constantValue(args[1]); isConstant && value <= 0 && isZeroOrOne(args[0]) {
+			return args[0]
+		}
+
+	case "not":
+		// 'not' swallows actions, so an argument that always acts is the same as 0.
+		if alwaysActs(args[0]) && !hasSideEffects(args[0]) {
+			return &ScriptNode{Type: Int, N: 1}
+		}
+		if isNot(args[0]) && isZeroOrOne(args[0].Children[1]) && !canAct(args[0].Children[1]) {
+			return args[0].Children[1]
+		}
+
+	case "+":
+		if isInt(args[0], 0) {
+			return args[1]
+		} else if isInt(args[1], 0) {
+			return args[0]
+		}
+
+	case "-":
+		if isInt(args[1], 0) {
+			return args[0]
+		} else if isInt(args[0], 0) {
+			return call("neg", args[1])
+		} else if sameCode(args[0], args[1]) && !hasEffects(args[0]) {
+			return &ScriptNode{Type: Int, N: 0}
+		}
+
+	case "*":
+		if isInt(args[0], 1) {
+			return args[1]
+		} else if isInt(args[1], 1) {
+			return args[0]
+		} else if (isInt(args[0], 0) && !hasEffects(args[1])) || (isInt(args[1], 0) && !hasEffects(args[0])) {
+			return &ScriptNode{Type: Int, N: 0}
+		}
+
+	case "/":
+		if isInt(args[1], 1) {
+			return args[0]
+		} else if (isInt(args[0], 0) || isInt(args[1], 0)) && !hasEffects(args[0]) && !hasEffects(args[1]) {
+			return &ScriptNode{Type: Int, N: 0}   // Dividing by zero gives 0 too.
+		}
+
+	case "mod":
+		if (isInt(args[0], 0) || isInt(args[1], 0) || isInt(args[1], 1)) && !hasEffects(args[0]) && !hasEffects(args[1]) {
+			return &ScriptNode{Type: Int, N: 0}
+		}
+
+	case "min", "max":
+		if sameCode(args[0], args[1]) && !hasEffects(args[0]) {
+			return args[0]
+		}
+
+	case "=", "<", ">":
+		if sameCode(args[0], args[1]) && !hasEffects(args[0]) {
+			return &ScriptNode{Type: Int, N: boolToInt(function.Name == "=")}
+		}
+
+	case "neg":
+		if isCall(args[0], "neg") {
+			return args[0].Children[1]
+		}
+
+	case "abs":
+		if isCall(args[0], "abs") {
+			return args[0]
+		} else if isCall(args[0], "neg") {
+			return call("abs", args[0].Children[1])
+		}
+	}
+
+	if strings.HasPrefix(function.Name, "call-") {
+		return s.rewriteCall(node, strToInt(strings.TrimPrefix(function.Name, "call-")))
+	}
+	if strings.HasPrefix(function.Name, "arg-") && (s.level >= NUM_SUBROUTINES || s.program == nil) {
+		return &ScriptNode{Type: Int, N: 0}   // There are no arguments outside of a subroutine.
+	}
+	return nil
+}
+
+// A call to a subroutine that we can't reach from here, or one that always returns the same number, is just that
+// number, as long as its arguments don't do anything.
+func (s *simplifier) rewriteCall(node *ScriptNode, n int) *ScriptNode {
+	for _, arg := range node.Children[1:] {
+		if hasEffects(arg) {
+			return nil
+		}
+	}
+	if n >= s.level || s.program == nil || n + 1 >= len(s.program.Children) {
+		return &ScriptNode{Type: Int, N: 0}
+	}
+	if body := s.program.Children[n + 1]; body.Type == Int {
+		return &ScriptNode{Type: Int, N: body.N}
+	}
+	return nil
+}
+
+// Replaces subroutines that nothing calls with 0, which is what the parser fills in for ones that aren't defined, so
+// that FormatScript leaves them out.
+func removeUnusedSubroutines(tree *ScriptNode) {
+	used := make([]bool, len(tree.Children) - 1)
+	markCalls(tree.Children[0], NUM_SUBROUTINES, used)
+	// Subroutines only call lower-numbered ones, so going from the top down catches every call.
+	for n := len(used) - 1; n >= 0; n-- {
+		if used[n] {
+			markCalls(tree.Children[n + 1], n, used)
+		}
+	}
+	for n := range used {
+		if !used[n] {
+			tree.Children[n + 1] = &ScriptNode{Type: Int, N: 0}
+		}
+	}
+}
+
+func markCalls(node *ScriptNode, level int, used []bool) {
+	if node.Type != Expr {
+		return
+	}
+	if name := node.Children[0].Func.Name; strings.HasPrefix(name, "call-") {
+		if n := strToInt(strings.TrimPrefix(name, "call-")); n < level && n < len(used) {
+			used[n] = true
+		}
+	}
+	for _, arg := range node.Children[1:] {
+		markCalls(arg, level, used)
+	}
+}
+
+// Returns true if the node returns an action every time it runs.
+func alwaysActs(node *ScriptNode) bool {
+	if node.Type != Expr {
+		return false
+	}
+	function := node.Children[0].Func
+	args := node.Children[1:]
+	switch function.Name {
+	case "if":
+		return alwaysActs(args[0]) || (alwaysActs(args[1]) && alwaysActs(args[2]))
+	case "and", "or":
+		return alwaysActs(args[0])
+	case "not":
+		return false
+	}
+	if function.Returns == TypeAction && !strings.HasPrefix(function.Name, "call-") {
+		return true
+	}
+	for _, arg := range args {
+		if alwaysActs(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the node might return an action. Subroutine calls count, since the subroutine could do anything.
+func canAct(node *ScriptNode) bool {
+	return containsFunction(node, func(function Function) bool {
+		return function.Returns == TypeAction || strings.HasPrefix(function.Name, "call-")
+	})
+}
+
+// Returns true if the node might change the state of the game (not counting actions) or use up a random number.
+func hasSideEffects(node *ScriptNode) bool {
+	return containsFunction(node, func(function Function) bool {
+		return EFFECTFUL_FUNCTIONS[function.Name] || strings.HasPrefix(function.Name, "call-")
+	})
+}
+
+// Returns true if evaluating the node could take an action or change the state of the game. Swapping it with
+// something else, running it twice, or not running it at all could change what the script does.
+func hasEffects(node *ScriptNode) bool {
+	return canAct(node) || hasSideEffects(node)
+}
+
+func containsFunction(node *ScriptNode, matches func(Function) bool) bool {
+	if node.Type != Expr {
+		return false
+	}
+	if matches(node.Children[0].Func) {
+		return true
+	}
+	for _, arg := range node.Children[1:] {
+		if containsFunction(arg, matches) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the node always returns 0 or 1 when it doesn't take an action.
+func isZeroOrOne(node *ScriptNode) bool {
+	if node.Type == Int {
+		return node.N == 0 || node.N == 1
+	}
+	function := node.Children[0].Func
+	// 'and' and 'or' return one of their arguments, so they don't count.
+	return function.Name == "not" || (function.Strict != nil && function.Returns == TypeBoolean)
+}
+
+func isInt(node *ScriptNode, n int) bool {
+	return node.Type == Int && node.N == n
+}
+
+func isCall(node *ScriptNode, name string) bool {
+	return node.Type == Expr && node.Children[0].Func.Name == name
+}
+
+func isNot(node *ScriptNode) bool {
+	return isCall(node, "not")
+}
+
+func sameCode(a, b *ScriptNode) bool {
+	return oneLine(a) == oneLine(b)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Builds a call to a function.
+func call(name string, args ...*ScriptNode) *ScriptNode {
+	children := []*ScriptNode{{Type: FuncName, Func: FunctionLookupTable[name]}}
+	return &ScriptNode{Type: Expr, Children: append(children, args...)}
+}
+
+// Returns true and the node's value if it always evaluates to the same number.
+func constantValue(node *ScriptNode) (bool, int) {
+	if node.Type == Int {
+		return true, node.N
+	} else if node.Type == Expr {
+		switch (node.Children[0].Func.Name) {
+		case "and":
+			if isConstant, values := constantArguments(node); isConstant {
+				if values[0] == 0 {
+					return true, 0
+				}
+				return true, values[1]
+			}
+		case "or":
+			// 'or' is tricky because not all of the arguments have to be constant; we just need one true constant to return.
+			for i := 1; i < len(node.Children); i++ {
+				isConstant, value := constantValue(node.Children[i])
+				if !isConstant {
+					return false, -1
+				}
+				if value > 0 {
+					return true, value
+				}
+			}
+			return true, 0
+		case "+":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, values[0] + values[1]
+			}
+		case "-":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, values[0] - values[1]
+			}
+		case "*":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, values[0] * values[1]
+			}
+		case "/":
+			if isConstant, values := constantArguments(node); isConstant {
+				if values[1] == 0 {
+					return true, 0
+				}
+				return true, values[0] / values[1]
+			}
+		case "mod":
+			if isConstant, values := constantArguments(node); isConstant {
+				if values[1] == 0 {
+					return true, 0
+				}
+				return true, values[0] % values[1]
+			}
+		case "min":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, intMin(values[0], values[1])
+			}
+		case "max":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, intMax(values[0], values[1])
+			}
+		case "neg":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, -values[0]
+			}
+		case "abs":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, intAbs(values[0])
+			}
+		case "<":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, boolToInt(values[0] < values[1])
+			}
+		case ">":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, boolToInt(values[0] > values[1])
+			}
+		case "=":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, boolToInt(values[0] == values[1])
+			}
+		case "not":
+			if isConstant, values := constantArguments(node); isConstant {
+				return true, boolToInt(values[0] <= 0)
+			}
+		}
+	}
+
+	return false, -1
+}
+
+func constantArguments(node *ScriptNode) (bool, []int) {
+	values := make([]int, len(node.Children) - 1)
+	for i := 1; i < len(node.Children); i++ {
+		isConstant, value := constantValue(node.Children[i])
+		if !isConstant {
+			return false, nil
+		}
+		values[i - 1] = value
+	}
+	return true, values
+}
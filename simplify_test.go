@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimplifyRecursively(t *testing.T) {
+	tests := map[string]string{
+		// Constant folding and identities happen all the way down the tree.
+		"(move (+ (tick) (* 2 (- 3 3))))": "(move (tick))\n",
+		"(move (* (my-x-pos) (+ 0 1)))": "(move (my-x-pos))\n",
+		"(move (* (tick) 0))": "(move 0)\n",
+		"(move (- (tick) 0))": "(move (tick))\n",
+		"(move (- 0 (neg (tick))))": "(move (tick))\n",
+		"(move (/ (tick) 1))": "(move (tick))\n",
+		"(move (mod (tick) 1))": "(move 0)\n",
+		"(move (- (tick) (tick)))": "(move 0)\n",
+		"(move (abs (neg (abs (tick)))))": "(move (abs (tick)))\n",
+		"(move (min (tick) (tick)))": "(move (tick))\n",
+		"(if (enemy-visible?) (move (+ 1 1)) (move 2))": "(move 2)\n",
+		"(if (enemy-visible?) 1 0)": "(enemy-visible?)\n",
+		"(if (< (tick) (tick)) (shoot-nearest) (move 1))": "(move 1)\n",
+		"(if (> 3 -2) (shoot-nearest) (move 1))": "(shoot-nearest)\n",
+		"(if -1 (shoot-nearest) (move 1))": "(move 1)\n",
+		"(if (not (not (tick))) (shoot-nearest) (move 1))": "(if (tick)\n  (shoot-nearest)\n  (move 1))\n",
+		"(and (not (not (enemy-visible?))) (shoot-nearest))": "(and (enemy-visible?) (shoot-nearest))\n",
+		"(and 3 (shoot-nearest))": "(shoot-nearest)\n",
+		"(or 0 (can-move? 1))": "(can-move? 1)\n",
+		"(or -4 2)": "2\n",
+		"(or -4 -2)": "0\n",
+		"(not -3)": "1\n",
+		"(and (tick) 0)": "0\n",
+
+		// Nothing after an action ever runs.
+		"(+ (move 1) (shoot-nearest))": "(move 1)\n",
+		"(and (shoot 2) (tick))": "(shoot 2)\n",
+		"(or (move 3) (tick))": "(move 3)\n",
+		"(< (tick) (if (tick) (move 1) (move 2)))": "(if (tick)\n  (move 1)\n  (move 2))\n",
+		"(not (move 1))": "1\n",
+		"(if (not (not (move 1))) (move 2) (move 3))": "(move 3)\n",
+
+		// Subroutines that can't be called, or that always return the same number.
+		"(defun 0 (move 1)) (shoot-nearest)": "(shoot-nearest)\n",
+		"(defun 0 (+ 2 2)) (move (call-0 (tick) 1))": "(move 4)\n",
+		"(defun 0 (move (arg-1))) (move (+ (arg-0) 1))": "(move 1)\n",
+		"(defun 0 (move (call-1 1 2))) (defun 1 (move (arg-0))) (call-1 2 3)": "(defun 1\n  (move (arg-0)))\n\n(call-1 2 3)\n",
+	}
+
+	for before, after := range tests {
+		code := MustParseScript(before)
+		SimplifyTree(code)
+		assert.Equal(t, after, FormatScript(code), before)
+	}
+}
+
+func TestSimplifyKeepsEffects(t *testing.T) {
+	// None of these can be simplified without changing what the script does.
+	unchanged := []string{
+		"(move (* (store 1 2) 0))",
+		"(move (* (rand 5) 0))",
+		"(move (- (rand 5) (rand 5)))",
+		"(+ (store 1 2) (move 1))",
+		"(if (store 1 2) (move 1) (move 1))",
+		"(not (move (rand 3)))",
+		"(if (not (not (move (rand 3)))) (move 2) (move 3))",
+		"(or (tick) 0)",
+		"(and (if (tick) (move 1) 2) 0)",
+	}
+
+	for _, before := range unchanged {
+		code := MustParseScript(before)
+		SimplifyTree(code)
+		assert.Equal(t, FormatScript(MustParseScript(before)), FormatScript(code), before)
+	}
+}
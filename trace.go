@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Records which parts of each bot's script ran on each tick, so that we can work out why a bot did what it did.
+// Tracing walks the tree instead of running the compiled script, so it's too slow to leave on during a generation.
+type Tracer struct {
+	Traces []BotTrace
+	numbers map[*ScriptNode]int   // Where each node comes in its script. See numberNodes.
+	scripts map[*ScriptNode]bool  // The scripts whose nodes we've already numbered
+}
+
+// One bot's turn: the nodes that it evaluated, in order, and what it ended up doing.
+type BotTrace struct {
+	Tick int
+	BotId int
+	Team Team
+	Path []*ScriptNode
+	Action Action
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{[]BotTrace{}, make(map[*ScriptNode]int), make(map[*ScriptNode]bool)}
+}
+
+func (t *Tracer) record(s *Script, path []*ScriptNode, action Action) {
+	if !t.scripts[s.Code] {
+		t.numberNodes(s.Code, 0)
+		t.scripts[s.Code] = true
+	}
+	bot := s.State.CurrentBot
+	t.Traces = append(t.Traces, BotTrace{s.State.Tick, bot.Id, bot.Team, append([]*ScriptNode{}, path...), action})
+}
+
+// Nodes are numbered depth-first: the main body first, then each subroutine in turn. Function names and the Program
+// node don't get numbers, since they're never evaluated on their own.
+func (t *Tracer) numberNodes(node *ScriptNode, next int) int {
+	if node.Type == Expr || node.Type == Int {
+		t.numbers[node] = next
+		next++
+	}
+	for _, child := range node.Children {
+		next = t.numberNodes(child, next)
+	}
+	return next
+}
+
+// Describes a node in a path as its number and either its function name or its value, like "4:if" or "7:-2".
+func (t *Tracer) label(node *ScriptNode) string {
+	if node.Type == Int {
+		return fmt.Sprintf("%d:%d", t.numbers[node], node.N)
+	}
+	return fmt.Sprintf("%d:%s", t.numbers[node], node.Children[0].Func.Name)
+}
+
+// The numbers of the nodes in the path, in the order they ran.
+func (t *Tracer) Numbers(trace BotTrace) []int {
+	numbers := make([]int, len(trace.Path))
+	for i, node := range trace.Path {
+		numbers[i] = t.numbers[node]
+	}
+	return numbers
+}
+
+// The path as a space-separated list of labels.
+func (t *Tracer) FormatPath(trace BotTrace) string {
+	labels := make([]string, len(trace.Path))
+	for i, node := range trace.Path {
+		labels[i] = t.label(node)
+	}
+	return strings.Join(labels, " ")
+}
+
+// Writes every trace as a CSV row: tick,bot,team,action,x,y,path. For a wait, the target is -1,-1.
+func (t *Tracer) FormatCSV() string {
+	var sb strings.Builder
+	sb.WriteString("tick,bot,team,action,x,y,path\n")
+	for _, trace := range t.Traces {
+		action, x, y := "wait", -1, -1
+		switch trace.Action.Type {
+		case ActionMove:
+			action, x, y = "move", trace.Action.Target.X, trace.Action.Target.Y
+		case ActionShoot:
+			action, x, y = "shoot", trace.Action.Target.X, trace.Action.Target.Y
+		}
+		sb.WriteString(fmt.Sprintf("%d,%d,%d,%s,%d,%d,%s\n", trace.Tick, trace.BotId, trace.Team, action, x, y, t.FormatPath(trace)))
+	}
+	return sb.String()
+}
+
+// Turns on tracing for every bot in the match.
+func (m *Match) EnableTracing(tracer *Tracer) {
+	for i := range m.State.Bots {
+		m.State.Bots[i].Script.Tracer = tracer
+	}
+}
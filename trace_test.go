@@ -0,0 +1,65 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracing(t *testing.T) {
+	arena := smallTestArena()
+	state := NewGameState(arena)
+	state.CurrentBot = &state.Bots[0]
+	tracer := NewTracer()
+	script := NewScript(MustParseScript("(defun 0 (move (arg-1))) (if (< (tick) 1) (call-0 1 2) (shoot-nearest))"), state)
+	script.Tracer = tracer
+
+	result := script.Run()
+	assert.Equal(t, ActionMove, result.Action.Type)
+	state.Tick++
+	state.CurrentBot = &state.Bots[5]
+	state.CurrentBot.Position = &arena.Cells[2 * arena.Height + 1]
+	script.Run()
+
+	assert.Equal(t, 2, len(tracer.Traces))
+	assert.Equal(t, "0:if 1:< 2:tick 3:1 4:call-0 5:1 6:2 8:move 9:arg-1", tracer.FormatPath(tracer.Traces[0]))
+	assert.Equal(t, "0:if 1:< 2:tick 3:1 7:shoot-nearest", tracer.FormatPath(tracer.Traces[1]))
+	assert.Equal(t, "tick,bot,team,action,x,y,path\n" +
+	                "0,0,0,move,1,2,0:if 1:< 2:tick 3:1 4:call-0 5:1 6:2 8:move 9:arg-1\n" +
+	                "1,5,1,shoot,1,1,0:if 1:< 2:tick 3:1 7:shoot-nearest\n", tracer.FormatCSV())
+
+	// Tracing has to give the same results as running the compiled script.
+	script.Tracer = nil
+	assert.Equal(t, Action{Type: ActionShoot, Target: &arena.Cells[1 * arena.Height + 1]}, script.Run().Action)
+}
+
+func TestDrawTrace(t *testing.T) {
+	arena := smallTestArena()
+	state := NewGameState(arena)
+	state.CurrentBot = &state.Bots[0]
+	tracer := NewTracer()
+	state.CurrentBot.Script = NewScript(MustParseScript("(if (< (tick) 1) (move 1) (shoot-nearest))"), state)
+	state.CurrentBot.Script.Tracer = tracer
+	state.CurrentBot.Script.Run()
+
+	writer := NewImageWriter("trace", 4)
+	t.Cleanup(func() { os.RemoveAll(writer.Dir) })
+	writer.ReserveTracePanel(arena, 7)
+	assert.Equal(t, TRACE_PIXELS_PER_NODE, writer.PanelHeight)
+	writer.StartImage(arena)
+	writer.DrawTrace(state, tracer, tracer.Traces[0])
+
+	// Everything but the `shoot-nearest` ran, and there's nothing after it.
+	nodeColor := func(n int) color.Color {
+		return writer.CurrentImage.Image.At(n * TRACE_PIXELS_PER_NODE, arena.Height * 4)
+	}
+	for n := 0; n < 6; n++ {
+		assert.Equal(t, color.RGBA{255, 0, 0, 255}, nodeColor(n), n)
+	}
+	assert.Equal(t, color.RGBA{200, 200, 200, 255}, nodeColor(6))
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, nodeColor(7))
+	assert.Equal(t, color.RGBA{255, 200, 0, 255}, writer.CurrentImage.Image.At(state.CurrentBot.Position.X * 4,
+	                                                                             state.CurrentBot.Position.Y * 4))
+}
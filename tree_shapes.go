@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sort"
+)
+
+// How big and how deep a set of scripts are, so that we can see how varied they are and whether they're bloating.
+// Sizes are counted in expressions rather than bytes, so that long numbers and function names don't make scripts look
+// bigger than they are.
+type ShapeStats struct {
+	Scripts int
+	AverageSize float64
+	AverageDepth float64
+	Depths []DepthStats   // One for each depth that at least one script has, shallowest first
+}
+
+// The sizes of the scripts that are all the same depth.
+type DepthStats struct {
+	Depth int
+	Scripts int
+	MinSize int
+	MaxSize int
+	AverageSize float64
+}
+
+func MeasureShapes(trees []*ScriptNode) ShapeStats {
+	stats := ShapeStats{Scripts: len(trees)}
+	if len(trees) == 0 {
+		return stats
+	}
+
+	byDepth := make(map[int]*DepthStats)
+	totalSize, totalDepth := 0, 0
+	for _, tree := range trees {
+		size, depth := tree.Size(), tree.Depth()
+		totalSize += size
+		totalDepth += depth
+
+		d, ok := byDepth[depth]
+		if !ok {
+			d = &DepthStats{Depth: depth, MinSize: size, MaxSize: size}
+			byDepth[depth] = d
+		}
+		d.Scripts++
+		d.MinSize = intMin(d.MinSize, size)
+		d.MaxSize = intMax(d.MaxSize, size)
+		d.AverageSize += float64(size)   // Turned into an average below
+	}
+
+	stats.AverageSize = float64(totalSize) / float64(len(trees))
+	stats.AverageDepth = float64(totalDepth) / float64(len(trees))
+	for _, d := range byDepth {
+		d.AverageSize /= float64(d.Scripts)
+		stats.Depths = append(stats.Depths, *d)
+	}
+	sort.Slice(stats.Depths, func(i, j int) bool {
+		return stats.Depths[i].Depth < stats.Depths[j].Depth
+	})
+	return stats
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasureShapes(t *testing.T) {
+	trees := []*ScriptNode{
+		MustParseScript("(shoot-nearest)"),
+		MustParseScript("(move 1)"),
+		MustParseScript("(move (+ 1 2))"),
+		MustParseScript("(shoot (if (enemy-visible?) 1 2))"),
+	}
+	stats := MeasureShapes(trees)
+
+	assert.Equal(t, 4, stats.Scripts)
+	assert.InDelta(t, 3.0, stats.AverageSize, 0.001)
+	assert.InDelta(t, 2.25, stats.AverageDepth, 0.001)
+	assert.Equal(t, []DepthStats{
+		{Depth: 1, Scripts: 1, MinSize: 1, MaxSize: 1, AverageSize: 1},
+		{Depth: 2, Scripts: 1, MinSize: 2, MaxSize: 2, AverageSize: 2},
+		{Depth: 3, Scripts: 2, MinSize: 4, MaxSize: 5, AverageSize: 4.5},
+	}, stats.Depths)
+
+	assert.Equal(t, ShapeStats{}, MeasureShapes(nil))
+}
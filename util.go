@@ -73,6 +73,22 @@ func intAbs(n int) int {
 	}
 }
 
+func intMin(a, b int) int {
+	if a < b {
+		return a
+	} else {
+		return b
+	}
+}
+
+func intMax(a, b int) int {
+	if a > b {
+		return a
+	} else {
+		return b
+	}
+}
+
 // Each team considers "north" to be the direction of the enemy's goal, and "south" to be the direction of its own side.
 // This, plus the symmetry of the map, allows a script to run identically regardless of whether it's controlling Team A
 // or Team B.
@@ -97,6 +113,28 @@ func relativeToAbsoluteDirection(relative Direction, team Team) Direction {
 	return North
 }
 
+// The inverse of relativeToAbsoluteDirection.
+func absoluteToRelativeDirection(absolute Direction, team Team) Direction {
+	for relative := North; relative < NumberOfDirections; relative++ {
+		if relativeToAbsoluteDirection(relative, team) == absolute {
+			return relative
+		}
+	}
+	logger.Fatalf("Weird direction %d for team %d!", absolute, team)
+	return North
+}
+
+// Finds a name in one of the lists of names for the scenario's settings, like MUTATION_OPERATOR_NAMES, and returns
+// its position. `kind` says what the names are for in the error message.
+func lookUpName(names []string, name string, kind string) (int, error) {
+	for i, n := range names {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("No such %s: '%s'", kind, name)
+}
+
 func strToInt(s string) int {
 	number, err := strconv.Atoi(s)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 type Visualizer interface {
 	Init(state *GameState)     // Called when the game state is initialized
 	Update(action Action)      // Called once per action to tell the visualizer to record the current state
+	Broadcast(b Broadcast)     // Called when a bot writes to its team's blackboard, before the Update for its action
 	NoChange()                 // Time advanced, but the game state wasn't changed in any way
 	TickComplete()             // Called at the end of a tick, once all robots have taken a turn
 	Finish()                   // Cleans up and writes whatever output is required
@@ -23,13 +24,16 @@ type GifVisualizer struct {
 	FileManager *FileManager
 	State *GameState
 	img ImageWriter
+	broadcasts []Broadcast
 }
 
 // Uses ImageWriter to generate a bunch of images, one per action, then stitches them together into a movie.
 type Mp4Visualizer struct {
 	FileManager *FileManager
 	State *GameState
+	Tracer *Tracer  // If present, each frame also shows which parts of the bot's script ran to get that action.
 	img ImageWriter
+	broadcasts []Broadcast
 }
 
 // Each grid cell in the arena will be PIXELS_PER_CELL pixels wide in the output images.
@@ -41,12 +45,13 @@ func NewNullVisualizer() *NullVisualizer {
 
 func (vis *NullVisualizer) Init(state *GameState) {}
 func (vis *NullVisualizer) Update(action Action) {}
+func (vis *NullVisualizer) Broadcast(b Broadcast) {}
 func (vis *NullVisualizer) NoChange() {}
 func (vis *NullVisualizer) TickComplete() {}
 func (vis *NullVisualizer) Finish() {}
 
 func NewGifVisualizer(fm *FileManager) *GifVisualizer {
-	return &GifVisualizer{fm, nil, NewImageWriter("tick", DEFAULT_PIXELS_PER_CELL)}
+	return &GifVisualizer{fm, nil, NewImageWriter("tick", DEFAULT_PIXELS_PER_CELL), []Broadcast{}}
 }
 
 func (vis *GifVisualizer) Init(state *GameState) {
@@ -60,6 +65,10 @@ func (vis *GifVisualizer) Update(action Action) {
 	// generates one image per tick rather than one image per robot move.
 }
 
+func (vis *GifVisualizer) Broadcast(b Broadcast) {
+	vis.broadcasts = append(vis.broadcasts, b)
+}
+
 func (vis *GifVisualizer) NoChange() {
 	// No-op.
 	// Because we only show one frame per tick, we don't care about keeping the intervals between actions consistent.
@@ -77,20 +86,40 @@ func (vis *GifVisualizer) Finish() {
 		logger.Fatalf("Failed to run 'convert': %v", err)
 	}
 	logger.Printf("Created GIF at %s/game.gif", vis.FileManager.GenerationDir())
+	vis.FileManager.WriteBroadcasts(vis.broadcasts)
 }
 
 func NewMp4Visualizer(fm *FileManager) *Mp4Visualizer {
-	return &Mp4Visualizer{fm, nil, NewImageWriter("frame", DEFAULT_PIXELS_PER_CELL)}
+	return &Mp4Visualizer{fm, nil, nil, NewImageWriter("frame", DEFAULT_PIXELS_PER_CELL), []Broadcast{}}
 }
 
 func (vis *Mp4Visualizer) Init(state *GameState) {
 	vis.State = state
+	if vis.Tracer != nil {
+		// Every frame has to be the same size, so the panel has to fit the bigger of the two scripts.
+		maxSize := 0
+		for _, bot := range state.Bots {
+			maxSize = intMax(maxSize, bot.Script.Code.Size())
+		}
+		vis.img.ReserveTracePanel(state.Arena, maxSize)
+	}
 	// Before the first action of the game, write an image showing the initial game state.
 	vis.img.WriteImage(state, nil)
 }
 
 func (vis *Mp4Visualizer) Update(action Action) {
-	vis.img.WriteImage(vis.State, &action)
+	if vis.Tracer == nil || len(vis.Tracer.Traces) == 0 {
+		vis.img.WriteImage(vis.State, &action)
+		return
+	}
+	vis.img.StartImage(vis.State.Arena)
+	vis.img.DrawGameState(vis.State, &action)
+	vis.img.DrawTrace(vis.State, vis.Tracer, vis.Tracer.Traces[len(vis.Tracer.Traces) - 1])
+	vis.img.FinishImage()
+}
+
+func (vis *Mp4Visualizer) Broadcast(b Broadcast) {
+	vis.broadcasts = append(vis.broadcasts, b)
 }
 
 // We write images on the turns of dead robots so that the speed of the visualization stays consistent, instead of
@@ -111,6 +140,7 @@ func (vis *Mp4Visualizer) Finish() {
 		logger.Fatalf("Failed to run 'ffmpeg': %v", err)
 	}
 	logger.Printf("Created MP4 at %s/game.mp4", vis.FileManager.GenerationDir())
+	vis.FileManager.WriteBroadcasts(vis.broadcasts)
 
 	if err := os.RemoveAll(vis.img.Dir); err != nil {
 		logger.Fatalf("Could not destroy temporary directory %s: %v", vis.img.Dir, err)